@@ -0,0 +1,325 @@
+package fnrun
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// cloudEventsContentType is the media type of a CloudEvent in structured mode.
+const cloudEventsContentType = "application/cloudevents+json"
+
+// cloudEventsSpecVersion is the version of the CloudEvents specification that
+// is produced by WriteCloudEvent.
+const cloudEventsSpecVersion = "1.0"
+
+// cloudEventEnvPrefix is the prefix of the environment variables that carry
+// CloudEvent attributes in the execution context and in Result env.
+const cloudEventEnvPrefix = "CE_"
+
+// CloudEvent represents an event in the CloudEvents format.
+//
+// Only the attributes defined by the CloudEvents specification are represented
+// as fields; any extension attributes are kept in Extensions, keyed by their
+// lower-case name.
+type CloudEvent struct {
+	ID              string
+	Source          string
+	SpecVersion     string
+	Type            string
+	Subject         string
+	Time            string
+	DataContentType string
+	DataSchema      string
+	Extensions      map[string]string
+	Data            []byte
+}
+
+// ReadCloudEvent reads a CloudEvent from an HTTP request in either the binary
+// or structured content mode of the CloudEvents HTTP protocol binding.
+//
+// Only JSON is supported as the event format for structured mode.
+func ReadCloudEvent(r *http.Request) (*CloudEvent, error) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	contentType := r.Header.Get("Content-Type")
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+
+	var event *CloudEvent
+	if mediaType == cloudEventsContentType {
+		event, err = parseStructuredCloudEvent(body)
+	} else {
+		event, err = parseBinaryCloudEvent(r.Header, body)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return event, event.validate()
+}
+
+func parseBinaryCloudEvent(header http.Header, body []byte) (*CloudEvent, error) {
+	event := &CloudEvent{
+		DataContentType: header.Get("Content-Type"),
+		Extensions:      make(map[string]string),
+		Data:            body,
+	}
+
+	for name, values := range header {
+		lower := strings.ToLower(name)
+		if !strings.HasPrefix(lower, "ce-") || len(values) == 0 {
+			continue
+		}
+		event.setAttribute(strings.TrimPrefix(lower, "ce-"), values[0])
+	}
+
+	return event, nil
+}
+
+func parseStructuredCloudEvent(body []byte) (*CloudEvent, error) {
+	var attributes map[string]json.RawMessage
+	err := json.Unmarshal(body, &attributes)
+	if err != nil {
+		return nil, err
+	}
+
+	event := &CloudEvent{Extensions: make(map[string]string)}
+
+	for name, raw := range attributes {
+		if name == "data" || name == "data_base64" {
+			continue
+		}
+
+		var value string
+		if json.Unmarshal(raw, &value) != nil {
+			// Extension attributes may be numbers or booleans; keep their JSON
+			// representation.
+			value = string(raw)
+		}
+		event.setAttribute(name, value)
+	}
+
+	if raw, ok := attributes["data_base64"]; ok {
+		var encoded string
+		err = json.Unmarshal(raw, &encoded)
+		if err != nil {
+			return nil, err
+		}
+
+		event.Data, err = base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, err
+		}
+	} else if raw, ok := attributes["data"]; ok {
+		event.Data = []byte(raw)
+
+		// Data that is not JSON is carried as a JSON string.
+		var text string
+		if !isJSONContentType(event.DataContentType) && json.Unmarshal(raw, &text) == nil {
+			event.Data = []byte(text)
+		}
+	}
+
+	return event, nil
+}
+
+func (event *CloudEvent) setAttribute(name, value string) {
+	switch name {
+	case "id":
+		event.ID = value
+	case "source":
+		event.Source = value
+	case "specversion":
+		event.SpecVersion = value
+	case "type":
+		event.Type = value
+	case "subject":
+		event.Subject = value
+	case "time":
+		event.Time = value
+	case "datacontenttype":
+		event.DataContentType = value
+	case "dataschema":
+		event.DataSchema = value
+	default:
+		event.Extensions[name] = value
+	}
+}
+
+func (event *CloudEvent) attributes() map[string]string {
+	attributes := map[string]string{
+		"id":          event.ID,
+		"source":      event.Source,
+		"specversion": event.SpecVersion,
+		"type":        event.Type,
+		"subject":     event.Subject,
+		"time":        event.Time,
+		"dataschema":  event.DataSchema,
+	}
+
+	for name, value := range event.Extensions {
+		attributes[name] = value
+	}
+
+	for name, value := range attributes {
+		if value == "" {
+			delete(attributes, name)
+		}
+	}
+
+	return attributes
+}
+
+func (event *CloudEvent) validate() error {
+	switch {
+	case event.ID == "":
+		return errors.New("CloudEvent is missing required attribute: id")
+	case event.Source == "":
+		return errors.New("CloudEvent is missing required attribute: source")
+	case event.SpecVersion == "":
+		return errors.New("CloudEvent is missing required attribute: specversion")
+	case event.Type == "":
+		return errors.New("CloudEvent is missing required attribute: type")
+	}
+
+	return nil
+}
+
+// Env returns the attributes of the event as environment variables suitable
+// for WithEnv.
+//
+// Each attribute, including extensions and datacontenttype, is named CE_
+// followed by the upper-case attribute name; for example, CE_ID, CE_SOURCE,
+// CE_TYPE and CE_SUBJECT.
+func (event *CloudEvent) Env() map[string]string {
+	env := make(map[string]string)
+	for name, value := range event.attributes() {
+		env[cloudEventEnvPrefix+strings.ToUpper(name)] = value
+	}
+
+	if event.DataContentType != "" {
+		env[cloudEventEnvPrefix+"DATACONTENTTYPE"] = event.DataContentType
+	}
+
+	return env
+}
+
+// CloudEventFromResult builds a CloudEvent from the Result of an invocation.
+//
+// The attributes of the event are read from the CE_ variables in the Result
+// env, using the same naming as CloudEvent.Env, and the Result data becomes the
+// event data. The second return value is false if the Result does not describe
+// an event, which is the case when CE_TYPE is not set. If CE_ID is not set, a
+// random id is generated, and if CE_SOURCE is not set, source is used.
+func CloudEventFromResult(result *Result, source string) (*CloudEvent, bool) {
+	if result.Env[cloudEventEnvPrefix+"TYPE"] == "" {
+		return nil, false
+	}
+
+	event := &CloudEvent{
+		ID:          randomID(),
+		Source:      source,
+		SpecVersion: cloudEventsSpecVersion,
+		Extensions:  make(map[string]string),
+		Data:        result.Data,
+	}
+
+	for name, value := range result.Env {
+		if !strings.HasPrefix(name, cloudEventEnvPrefix) || value == "" {
+			continue
+		}
+		event.setAttribute(strings.ToLower(strings.TrimPrefix(name, cloudEventEnvPrefix)), value)
+	}
+
+	return event, true
+}
+
+// WriteCloudEvent writes event as an HTTP response in the binary content mode
+// of the CloudEvents HTTP protocol binding.
+func WriteCloudEvent(w http.ResponseWriter, status int, event *CloudEvent) error {
+	header := w.Header()
+	for name, value := range event.attributes() {
+		header.Set("ce-"+name, value)
+	}
+
+	if event.DataContentType != "" {
+		header.Set("Content-Type", event.DataContentType)
+	}
+
+	w.WriteHeader(status)
+	_, err := w.Write(event.Data)
+	return err
+}
+
+// NewCloudEventsHandler creates an http.Handler that invokes invoker for each
+// CloudEvent it receives in either binary or structured mode.
+//
+// The event data is passed as the Input data, and the event attributes are
+// added to the execution context as described by CloudEvent.Env. A request
+// that does not contain a valid CloudEvent receives a 400 Bad Request
+// response.
+//
+// If the Result describes an event, as determined by CloudEventFromResult, it
+// is written as a binary-mode CloudEvent reply with the source of the incoming
+// event as its default source. Otherwise, the Result is written in the same
+// way as by NewHTTPHandler. Errors are mapped to status codes as by
+// NewHTTPHandler.
+func NewCloudEventsHandler(invoker Invoker) http.Handler {
+	return &cloudEventsHandler{invoker: invoker}
+}
+
+type cloudEventsHandler struct {
+	invoker Invoker
+}
+
+func (h *cloudEventsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	event, err := ReadCloudEvent(r)
+	if err != nil {
+		writeHTTPError(w, http.StatusBadRequest)
+		return
+	}
+
+	ctx := WithEnv(r.Context(), event.Env())
+	result, err := h.invoker.Invoke(ctx, &Input{Data: event.Data})
+	if err != nil {
+		writeHTTPError(w, httpStatusForError(err))
+		return
+	}
+
+	reply, ok := CloudEventFromResult(result, event.Source)
+	if !ok {
+		writeHTTPResult(w, result)
+		return
+	}
+
+	WriteCloudEvent(w, httpStatusForResult(result), reply)
+}
+
+func isJSONContentType(contentType string) bool {
+	if contentType == "" {
+		return true
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	return mediaType == "application/json" || mediaType == "text/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// randomID returns a random 128-bit identifier encoded as hex.
+func randomID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
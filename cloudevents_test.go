@@ -0,0 +1,231 @@
+package fnrun
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestReadCloudEvent_binary(t *testing.T) {
+	req := httptest.NewRequest("POST", "/", strings.NewReader("some data"))
+	req.Header.Set("Content-Type", "text/plain")
+	req.Header.Set("ce-id", "1234")
+	req.Header.Set("ce-source", "/sensors/1")
+	req.Header.Set("ce-specversion", "1.0")
+	req.Header.Set("ce-type", "com.example.reading")
+	req.Header.Set("ce-subject", "temperature")
+	req.Header.Set("ce-traceparent", "abc")
+
+	event, err := ReadCloudEvent(req)
+
+	if err != nil {
+		t.Fatalf("ReadCloudEvent() returned err: %+v", err)
+	}
+
+	assertCloudEvent(t, event, "some data", "text/plain")
+}
+
+func TestReadCloudEvent_structured(t *testing.T) {
+	t.Run("with text data", func(t *testing.T) {
+		body := `{"id":"1234","source":"/sensors/1","specversion":"1.0",` +
+			`"type":"com.example.reading","subject":"temperature","traceparent":"abc",` +
+			`"datacontenttype":"text/plain","data":"some data"}`
+		event := readStructuredCloudEvent(t, body)
+
+		assertCloudEvent(t, event, "some data", "text/plain")
+	})
+
+	t.Run("with JSON data", func(t *testing.T) {
+		body := `{"id":"1234","source":"/sensors/1","specversion":"1.0",` +
+			`"type":"com.example.reading","subject":"temperature","traceparent":"abc",` +
+			`"data":{"value":21}}`
+		event := readStructuredCloudEvent(t, body)
+
+		assertCloudEvent(t, event, `{"value":21}`, "")
+	})
+
+	t.Run("with base64 data", func(t *testing.T) {
+		body := `{"id":"1234","source":"/sensors/1","specversion":"1.0",` +
+			`"type":"com.example.reading","subject":"temperature","traceparent":"abc",` +
+			`"datacontenttype":"application/octet-stream","data_base64":"c29tZSBkYXRh"}`
+		event := readStructuredCloudEvent(t, body)
+
+		assertCloudEvent(t, event, "some data", "application/octet-stream")
+	})
+}
+
+func TestReadCloudEvent_missingAttribute(t *testing.T) {
+	req := httptest.NewRequest("POST", "/", strings.NewReader("some data"))
+	req.Header.Set("ce-id", "1234")
+	req.Header.Set("ce-specversion", "1.0")
+	req.Header.Set("ce-type", "com.example.reading")
+
+	_, err := ReadCloudEvent(req)
+
+	if err == nil {
+		t.Errorf("ReadCloudEvent() did not return error")
+	}
+}
+
+func TestCloudEvent_Env(t *testing.T) {
+	event := &CloudEvent{
+		ID:              "1234",
+		Source:          "/sensors/1",
+		SpecVersion:     "1.0",
+		Type:            "com.example.reading",
+		DataContentType: "text/plain",
+		Extensions:      map[string]string{"traceparent": "abc"},
+	}
+
+	env := event.Env()
+
+	want := map[string]string{
+		"CE_ID":              "1234",
+		"CE_SOURCE":          "/sensors/1",
+		"CE_SPECVERSION":     "1.0",
+		"CE_TYPE":            "com.example.reading",
+		"CE_DATACONTENTTYPE": "text/plain",
+		"CE_TRACEPARENT":     "abc",
+	}
+
+	if len(env) != len(want) {
+		t.Errorf("Expected %d env vars, but got %d: %+v", len(want), len(env), env)
+	}
+
+	for name, value := range want {
+		if env[name] != value {
+			t.Errorf("Env %s: got %q; want %q", name, env[name], value)
+		}
+	}
+}
+
+func TestCloudEventFromResult(t *testing.T) {
+	t.Run("without a type", func(t *testing.T) {
+		_, ok := CloudEventFromResult(&Result{}, "/source")
+
+		if ok {
+			t.Errorf("Expected result without CE_TYPE not to be an event")
+		}
+	})
+
+	t.Run("with a type", func(t *testing.T) {
+		result := &Result{
+			Data: []byte("reply"),
+			Env:  map[string]string{"CE_TYPE": "com.example.reply", "CE_COLOR": "blue"},
+		}
+
+		event, ok := CloudEventFromResult(result, "/source")
+
+		if !ok {
+			t.Fatalf("Expected result with CE_TYPE to be an event")
+		}
+
+		if event.Type != "com.example.reply" || event.Source != "/source" || event.ID == "" {
+			t.Errorf("Unexpected event attributes: %+v", event)
+		}
+
+		if event.Extensions["color"] != "blue" {
+			t.Errorf("Expected extension color=blue, but got: %+v", event.Extensions)
+		}
+	})
+}
+
+func TestCloudEventsHandler_ServeHTTP(t *testing.T) {
+	invoker := FuncInvoker(func(ctx context.Context, input *Input) (*Result, error) {
+		env, _ := Env(ctx)
+		result := &Result{
+			Status: http.StatusOK,
+			Data:   append([]byte("got "), input.Data...),
+			Env: map[string]string{
+				"CE_TYPE":            env["CE_TYPE"] + ".reply",
+				"CE_SUBJECT":         env["CE_SUBJECT"],
+				"CE_DATACONTENTTYPE": "text/plain",
+			},
+		}
+		return result, nil
+	})
+
+	req := httptest.NewRequest("POST", "/", strings.NewReader("some data"))
+	req.Header.Set("ce-id", "1234")
+	req.Header.Set("ce-source", "/sensors/1")
+	req.Header.Set("ce-specversion", "1.0")
+	req.Header.Set("ce-type", "com.example.reading")
+	req.Header.Set("ce-subject", "temperature")
+	rec := httptest.NewRecorder()
+
+	NewCloudEventsHandler(invoker).ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected status %d, but got %d", http.StatusOK, rec.Code)
+	}
+
+	headers := map[string]string{
+		"ce-type":        "com.example.reading.reply",
+		"ce-source":      "/sensors/1",
+		"ce-subject":     "temperature",
+		"ce-specversion": "1.0",
+		"Content-Type":   "text/plain",
+	}
+	for name, want := range headers {
+		if got := rec.Header().Get(name); got != want {
+			t.Errorf("Header %s: got %q; want %q", name, got, want)
+		}
+	}
+
+	if body := rec.Body.String(); body != "got some data" {
+		t.Errorf("Expected body 'got some data', but got %q", body)
+	}
+}
+
+func TestCloudEventsHandler_ServeHTTP_invalidEvent(t *testing.T) {
+	invoker := FuncInvoker(func(context.Context, *Input) (*Result, error) {
+		t.Errorf("Invoke() should not be called for an invalid event")
+		return &Result{}, nil
+	})
+
+	req := httptest.NewRequest("POST", "/", strings.NewReader("some data"))
+	rec := httptest.NewRecorder()
+
+	NewCloudEventsHandler(invoker).ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, but got %d", http.StatusBadRequest, rec.Code)
+	}
+}
+
+func readStructuredCloudEvent(t *testing.T, body string) *CloudEvent {
+	t.Helper()
+
+	req := httptest.NewRequest("POST", "/", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/cloudevents+json; charset=utf-8")
+
+	event, err := ReadCloudEvent(req)
+	if err != nil {
+		t.Fatalf("ReadCloudEvent() returned err: %+v", err)
+	}
+
+	return event
+}
+
+func assertCloudEvent(t *testing.T, event *CloudEvent, data, contentType string) {
+	t.Helper()
+
+	if event.ID != "1234" || event.Source != "/sensors/1" || event.SpecVersion != "1.0" ||
+		event.Type != "com.example.reading" || event.Subject != "temperature" {
+		t.Errorf("Unexpected event attributes: %+v", event)
+	}
+
+	if event.Extensions["traceparent"] != "abc" {
+		t.Errorf("Expected extension traceparent=abc, but got: %+v", event.Extensions)
+	}
+
+	if event.DataContentType != contentType {
+		t.Errorf("DataContentType: got %q; want %q", event.DataContentType, contentType)
+	}
+
+	if string(event.Data) != data {
+		t.Errorf("Data: got %q; want %q", event.Data, data)
+	}
+}
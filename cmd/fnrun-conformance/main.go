@@ -0,0 +1,63 @@
+// Command fnrun-conformance checks that a function program speaks the fnrun
+// protocol correctly.
+//
+// Usage:
+//
+//	fnrun-conformance [-socket] [-timeout duration] command [args...]
+//
+// The command must echo each invocation, returning the input data as the
+// result data and the environment variables of the execution context as the
+// result env. A line is printed for each case, and the exit status is 1 if any
+// case fails.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/tessellator/fnrun"
+	"github.com/tessellator/fnrun/conformance"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("fnrun-conformance", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	socket := flags.Bool("socket", false, "communicate over a Unix socket instead of stdin and stdout")
+	timeout := flags.Duration("timeout", 10*time.Second, "time allowed for each invocation")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: fnrun-conformance [-socket] [-timeout duration] command [args...]")
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	config := conformance.Config{Timeout: *timeout}
+	if *socket {
+		config.Transport = fnrun.SocketTransport
+	}
+
+	cmd := exec.Command(flags.Arg(0), flags.Args()[1:]...)
+	cmd.Stderr = stderr
+
+	report := conformance.Run(cmd, config)
+	report.WriteTo(stdout)
+
+	if !report.Passed() {
+		return 1
+	}
+	return 0
+}
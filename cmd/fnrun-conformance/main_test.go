@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/tessellator/fnrun"
+	"github.com/tessellator/fnrun/fnruntest"
+)
+
+func TestRun(t *testing.T) {
+	os.Setenv(fnruntest.SubprocessEnvVar, "1")
+	defer os.Unsetenv(fnruntest.SubprocessEnvVar)
+
+	tests := []struct {
+		name     string
+		args     []string
+		wantCode int
+		wantOut  string
+	}{
+		{"conforming", []string{os.Args[0], "-test.run=^TestEchoFunction$"}, 0, "0 failed"},
+		{"socket", []string{"-socket", os.Args[0], "-test.run=^TestEchoFunction$"}, 0, "0 failed"},
+		{"nonconforming", []string{os.Args[0], "-test.run=^TestDataOnlyFunction$"}, 1, "FAIL  many env vars"},
+		{"no command", nil, 2, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout := &bytes.Buffer{}
+
+			code := run(tt.args, stdout, &bytes.Buffer{})
+
+			if code != tt.wantCode {
+				t.Errorf("Expected exit code %d, but got: %d\n%s", tt.wantCode, code, stdout)
+			}
+
+			if !strings.Contains(stdout.String(), tt.wantOut) {
+				t.Errorf("Expected output to contain %q, but got:\n%s", tt.wantOut, stdout)
+			}
+		})
+	}
+}
+
+// ---
+
+func TestEchoFunction(t *testing.T) {
+	fnruntest.ServeSubprocess(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		env, _ := fnrun.Env(ctx)
+		return &fnrun.Result{Data: input.Data, Env: env}, nil
+	})
+}
+
+func TestDataOnlyFunction(t *testing.T) {
+	fnruntest.ServeSubprocess(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		return &fnrun.Result{Data: input.Data}, nil
+	})
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/tessellator/fnrun"
+)
+
+func runBench(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("fnrun bench", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	poolSize := flags.Int("pool-size", 1, "maximum number of invokers in the pool")
+	maxWait := flags.Duration("max-wait", time.Second, "maximum time to wait for an available invoker")
+	maxRunnable := flags.Duration("max-runnable", 30*time.Second, "maximum time allowed for each invocation")
+	concurrency := flags.Int("concurrency", 1, "number of concurrent requests")
+	rate := flags.Float64("rate", 0, "requests per second across all workers, or 0 for no limit")
+	requests := flags.Int("requests", 1000, "number of requests to send")
+	duration := flags.Duration("duration", 0, "stop sending requests after this long, if set")
+	size := flags.Int("size", 0, "size of the input data in bytes")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: fnrun bench [flags] command [args...]")
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() == 0 || *concurrency < 1 || *requests < 1 || *size < 0 || *rate < 0 {
+		flags.Usage()
+		return 2
+	}
+
+	fn := functionConfig{Command: flags.Arg(0), Args: flags.Args()[1:]}
+
+	config := fnrun.InvokerPoolConfig{
+		MaxInvokerCount: *poolSize,
+		InvokerFactory:  &timingInvokerFactory{factory: &functionInvokerFactory{fn: fn, stderr: stderr}},
+		MaxWaitDuration: *maxWait,
+		MaxRunnableTime: *maxRunnable,
+	}
+	pool, err := fnrun.NewInvokerPool(config)
+	if err != nil {
+		fmt.Fprintf(stderr, "fnrun bench: %v\n", err)
+		return 1
+	}
+
+	options := benchOptions{
+		concurrency: *concurrency,
+		rate:        *rate,
+		requests:    *requests,
+		duration:    *duration,
+		data:        make([]byte, *size),
+	}
+	report := bench(pool, options)
+
+	// The functions write to stderr until they exit.
+	pool.Close()
+
+	report.write(stdout)
+	return 0
+}
+
+// benchOptions describe the load generated by bench.
+type benchOptions struct {
+	concurrency int
+	rate        float64
+	requests    int
+	duration    time.Duration
+	data        []byte
+}
+
+// sample is the measurement of a single request.
+type sample struct {
+	total time.Duration
+
+	// exec is the time spent in the invoker, as opposed to waiting for one.
+	exec time.Duration
+
+	err error
+}
+
+type sampleCtxKey struct{}
+
+// timingInvokerFactory creates invokers that record how long each invocation
+// spends in the underlying invoker, so that it can be told apart from the time
+// spent waiting for the pool.
+type timingInvokerFactory struct {
+	factory fnrun.InvokerFactory
+}
+
+func (factory *timingInvokerFactory) NewInvoker() (fnrun.Invoker, error) {
+	invoker, err := factory.factory.NewInvoker()
+	if err != nil {
+		return nil, err
+	}
+	return &timingInvoker{invoker: invoker}, nil
+}
+
+type timingInvoker struct {
+	invoker fnrun.Invoker
+}
+
+func (ti *timingInvoker) Invoke(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+	start := time.Now()
+	result, err := ti.invoker.Invoke(ctx, input)
+	if s, ok := ctx.Value(sampleCtxKey{}).(*sample); ok {
+		s.exec = time.Since(start)
+	}
+	return result, err
+}
+
+// Close closes the underlying invoker so that the pool can stop it.
+func (ti *timingInvoker) Close() error {
+	if closer, ok := ti.invoker.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// bench sends requests to invoker as described by options and reports the
+// results.
+func bench(invoker fnrun.Invoker, options benchOptions) *benchReport {
+	jobs := make(chan struct{})
+	go func() {
+		defer close(jobs)
+
+		var tick <-chan time.Time
+		if options.rate > 0 {
+			ticker := time.NewTicker(time.Duration(float64(time.Second) / options.rate))
+			defer ticker.Stop()
+			tick = ticker.C
+		}
+
+		var stop <-chan time.Time
+		if options.duration > 0 {
+			timer := time.NewTimer(options.duration)
+			defer timer.Stop()
+			stop = timer.C
+		}
+
+		for i := 0; i < options.requests; i++ {
+			if tick != nil {
+				select {
+				case <-tick:
+				case <-stop:
+					return
+				}
+			}
+
+			select {
+			case jobs <- struct{}{}:
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	var mu sync.Mutex
+	var samples []sample
+	var wg sync.WaitGroup
+
+	start := time.Now()
+	for i := 0; i < options.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range jobs {
+				s := &sample{}
+				ctx := context.WithValue(context.Background(), sampleCtxKey{}, s)
+
+				begin := time.Now()
+				_, s.err = invoker.Invoke(ctx, &fnrun.Input{Data: options.data})
+				s.total = time.Since(begin)
+
+				mu.Lock()
+				samples = append(samples, *s)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	return newBenchReport(samples, time.Since(start))
+}
+
+// benchReport summarizes the samples of a benchmark.
+type benchReport struct {
+	elapsed time.Duration
+	count   int
+	errors  map[string]int
+
+	// The latencies of successful requests, sorted.
+	total []time.Duration
+	wait  []time.Duration
+	exec  []time.Duration
+}
+
+func newBenchReport(samples []sample, elapsed time.Duration) *benchReport {
+	report := &benchReport{
+		elapsed: elapsed,
+		count:   len(samples),
+		errors:  make(map[string]int),
+	}
+
+	for _, s := range samples {
+		if s.err != nil {
+			report.errors[errorKind(s.err)]++
+			continue
+		}
+		report.total = append(report.total, s.total)
+		report.wait = append(report.wait, s.total-s.exec)
+		report.exec = append(report.exec, s.exec)
+	}
+
+	for _, durations := range [][]time.Duration{report.total, report.wait, report.exec} {
+		sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+	}
+
+	return report
+}
+
+// errorKind groups errors for the error breakdown.
+func errorKind(err error) string {
+	switch err {
+	case fnrun.ErrAvailabilityTimeout:
+		return "availability timeout"
+	case context.DeadlineExceeded:
+		return "deadline exceeded"
+	case fnrun.ErrPoolClosed:
+		return "pool closed"
+	default:
+		return err.Error()
+	}
+}
+
+// percentile returns the pth percentile of sorted durations using the
+// nearest-rank method.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+
+	rank := int(p/100*float64(len(sorted))+0.5) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	if rank >= len(sorted) {
+		rank = len(sorted) - 1
+	}
+	return sorted[rank]
+}
+
+func (report *benchReport) write(w io.Writer) {
+	succeeded := len(report.total)
+	fmt.Fprintf(w, "Requests:   %d in %v (%.1f/s)\n", report.count, report.elapsed.Round(time.Millisecond), float64(report.count)/report.elapsed.Seconds())
+	fmt.Fprintf(w, "Succeeded:  %d\n", succeeded)
+	fmt.Fprintf(w, "Failed:     %d\n", report.count-succeeded)
+
+	kinds := make([]string, 0, len(report.errors))
+	for kind := range report.errors {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	for _, kind := range kinds {
+		fmt.Fprintf(w, "  %-22s %d\n", kind+":", report.errors[kind])
+	}
+
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "%-10s %10s %10s %10s %10s %10s\n", "Latency", "p50", "p90", "p99", "max", "mean")
+	report.writeLatency(w, "total", report.total)
+	report.writeLatency(w, "wait", report.wait)
+	report.writeLatency(w, "exec", report.exec)
+}
+
+func (report *benchReport) writeLatency(w io.Writer, name string, sorted []time.Duration) {
+	var sum time.Duration
+	for _, d := range sorted {
+		sum += d
+	}
+	var mean time.Duration
+	if len(sorted) > 0 {
+		mean = sum / time.Duration(len(sorted))
+	}
+
+	fmt.Fprintf(w, "%-10s %10v %10v %10v %10v %10v\n", name,
+		roundLatency(percentile(sorted, 50)),
+		roundLatency(percentile(sorted, 90)),
+		roundLatency(percentile(sorted, 99)),
+		roundLatency(percentile(sorted, 100)),
+		roundLatency(mean))
+}
+
+func roundLatency(d time.Duration) time.Duration {
+	return d.Round(time.Microsecond)
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tessellator/fnrun"
+	"github.com/tessellator/fnrun/fnruntest"
+)
+
+func TestPercentile(t *testing.T) {
+	sorted := []time.Duration{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+
+	tests := []struct {
+		p    float64
+		want time.Duration
+	}{
+		{0, 1},
+		{50, 5},
+		{90, 9},
+		{99, 10},
+		{100, 10},
+	}
+
+	for _, tt := range tests {
+		if got := percentile(sorted, tt.p); got != tt.want {
+			t.Errorf("percentile(%v) = %v; want %v", tt.p, got, tt.want)
+		}
+	}
+
+	if got := percentile(nil, 50); got != 0 {
+		t.Errorf("Expected 0 for no samples, but got: %v", got)
+	}
+}
+
+func TestBench(t *testing.T) {
+	var calls int32
+	invoker := fnrun.FuncInvoker(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		switch atomic.AddInt32(&calls, 1) % 4 {
+		case 0:
+			return nil, fnrun.ErrAvailabilityTimeout
+		case 1:
+			return nil, errors.New("boom")
+		}
+		return &fnrun.Result{Data: input.Data}, nil
+	})
+
+	report := bench(invoker, benchOptions{concurrency: 4, requests: 100, data: []byte("x")})
+
+	if report.count != 100 {
+		t.Errorf("Expected 100 requests, but got: %d", report.count)
+	}
+
+	if len(report.total) != 50 {
+		t.Errorf("Expected 50 successful requests, but got: %d", len(report.total))
+	}
+
+	if report.errors["availability timeout"] != 25 || report.errors["boom"] != 25 {
+		t.Errorf("Did not get expected error breakdown: %v", report.errors)
+	}
+}
+
+func TestBench_rateAndDuration(t *testing.T) {
+	invoker := fnruntest.NewRecorder(fnrun.FuncInvoker(func(context.Context, *fnrun.Input) (*fnrun.Result, error) {
+		return &fnrun.Result{}, nil
+	}))
+
+	report := bench(invoker, benchOptions{concurrency: 2, rate: 100, requests: 1000, duration: 200 * time.Millisecond})
+
+	// About 20 requests fit in 200ms at 100 requests per second.
+	if report.count < 5 || report.count > 30 {
+		t.Errorf("Expected about 20 requests, but got: %d", report.count)
+	}
+
+	if report.elapsed < 150*time.Millisecond {
+		t.Errorf("Expected the benchmark to run for its duration, but took: %v", report.elapsed)
+	}
+}
+
+func TestBenchReport_waitAndExec(t *testing.T) {
+	report := newBenchReport([]sample{
+		{total: 30 * time.Millisecond, exec: 10 * time.Millisecond},
+		{total: 10 * time.Millisecond, exec: 10 * time.Millisecond},
+		{total: time.Second, err: context.DeadlineExceeded},
+	}, time.Second)
+
+	if report.wait[0] != 0 || report.wait[1] != 20*time.Millisecond {
+		t.Errorf("Did not compute expected wait times: %v", report.wait)
+	}
+
+	if report.errors["deadline exceeded"] != 1 {
+		t.Errorf("Did not get expected error breakdown: %v", report.errors)
+	}
+
+	buf := &bytes.Buffer{}
+	report.write(buf)
+
+	for _, want := range []string{"Requests:   3", "Succeeded:  2", "deadline exceeded:", "wait", "exec"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("Expected report to contain %q, but got:\n%s", want, buf)
+		}
+	}
+}
+
+func TestRunBench(t *testing.T) {
+	os.Setenv(fnruntest.SubprocessEnvVar, "1")
+	defer os.Unsetenv(fnruntest.SubprocessEnvVar)
+
+	stdout := &bytes.Buffer{}
+	stderr := &syncBuffer{}
+
+	args := []string{"bench", "-pool-size", "2", "-concurrency", "4", "-requests", "50", "-size", "1024",
+		os.Args[0], "-test.run=^TestGreetingFunction$"}
+	code := run(args, &bytes.Buffer{}, stdout, stderr)
+
+	if code != 0 {
+		t.Fatalf("Expected exit code 0, but got: %d\n%s", code, stderr)
+	}
+
+	if !strings.Contains(stdout.String(), "Succeeded:  50") {
+		t.Errorf("Expected all requests to succeed, but got:\n%s", stdout)
+	}
+}
+
+func TestRunBench_functionStderr(t *testing.T) {
+	os.Setenv(fnruntest.SubprocessEnvVar, "1")
+	defer os.Unsetenv(fnruntest.SubprocessEnvVar)
+
+	stderr := &syncBuffer{}
+
+	args := []string{"bench", "-requests", "1", os.Args[0], "-test.run=^TestLoggingFunction$"}
+	code := run(args, &bytes.Buffer{}, &bytes.Buffer{}, stderr)
+
+	if code != 0 {
+		t.Fatalf("Expected exit code 0, but got: %d\n%s", code, stderr)
+	}
+
+	if !strings.Contains(stderr.String(), "function log") {
+		t.Errorf("Expected the function stderr, but got: %s", stderr)
+	}
+}
+
+func TestRunBench_usage(t *testing.T) {
+	code := run([]string{"bench", "-concurrency", "0", "cat"}, &bytes.Buffer{}, &bytes.Buffer{}, &bytes.Buffer{})
+
+	if code != 2 {
+		t.Errorf("Expected exit code 2, but got: %d", code)
+	}
+}
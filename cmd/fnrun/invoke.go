@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/tessellator/fnrun"
+)
+
+// envFlag collects repeated KEY=VALUE flags.
+type envFlag map[string]string
+
+func (env envFlag) String() string {
+	return fmt.Sprint(map[string]string(env))
+}
+
+func (env envFlag) Set(value string) error {
+	i := strings.Index(value, "=")
+	if i <= 0 {
+		return errors.New("expected KEY=VALUE")
+	}
+	env[value[:i]] = value[i+1:]
+	return nil
+}
+
+func runInvoke(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	env := envFlag{}
+
+	flags := flag.NewFlagSet("fnrun invoke", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	input := flags.String("input", "-", "file to read the input data from, or - for stdin")
+	flags.Var(env, "env", "environment variable to send as KEY=VALUE; may be repeated")
+	timeout := flags.Duration("timeout", 30*time.Second, "time allowed for the invocation")
+	socket := flags.Bool("socket", false, "communicate over a Unix socket instead of stdin and stdout")
+	codecName := flags.String("codec", "protobuf", "protocol encoding: protobuf or jsonlines")
+	asJSON := flags.Bool("json", false, "print the result as JSON")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: fnrun invoke [flags] command [args...]")
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	config := fnrun.CmdInvokerConfig{}
+	if *socket {
+		config.Transport = fnrun.SocketTransport
+	}
+	switch *codecName {
+	case "protobuf":
+		config.Codec = fnrun.ProtobufCodec
+	case "jsonlines":
+		config.Codec = fnrun.JSONLinesCodec
+	default:
+		fmt.Fprintf(stderr, "fnrun invoke: unknown codec %q\n", *codecName)
+		return 2
+	}
+
+	data, err := readInput(*input, stdin)
+	if err != nil {
+		fmt.Fprintf(stderr, "fnrun invoke: %v\n", err)
+		return 1
+	}
+
+	cmd := exec.Command(flags.Arg(0), flags.Args()[1:]...)
+	cmd.Stderr = stderr
+	if *socket {
+		// Keep the output of the function apart from the result.
+		cmd.Stdout = stderr
+	}
+
+	result, err := invokeOnce(cmd, config, env, *timeout, data)
+	if err != nil {
+		fmt.Fprintf(stderr, "fnrun invoke: %v\n", err)
+		return 1
+	}
+
+	if *asJSON {
+		err = writeResultJSON(stdout, result)
+	} else {
+		err = writeResult(stdout, result)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "fnrun invoke: %v\n", err)
+		return 1
+	}
+
+	return 0
+}
+
+// invokeOnce starts cmd, performs a single invocation and stops cmd. The
+// process has exited when invokeOnce returns, so nothing else writes to the
+// outputs it was given.
+func invokeOnce(cmd *exec.Cmd, config fnrun.CmdInvokerConfig, env map[string]string, timeout time.Duration, data []byte) (*fnrun.Result, error) {
+	invoker, err := fnrun.NewCmdInvokerWithConfig(cmd, config)
+	if err != nil {
+		return nil, err
+	}
+	defer invoker.(io.Closer).Close()
+
+	ctx := fnrun.WithEnv(context.Background(), env)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	return invoker.Invoke(ctx, &fnrun.Input{Data: data})
+}
+
+func readInput(name string, stdin io.Reader) ([]byte, error) {
+	if name == "-" {
+		return ioutil.ReadAll(stdin)
+	}
+	return ioutil.ReadFile(name)
+}
+
+// writeResult writes result in a form meant to be read by people: the status
+// and env, each env var on its own line, followed by a blank line and the data.
+func writeResult(w io.Writer, result *fnrun.Result) error {
+	fmt.Fprintf(w, "Status: %d\n", result.Status)
+
+	names := make([]string, 0, len(result.Env))
+	for name := range result.Env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "Env: %s=%s\n", name, result.Env[name])
+	}
+
+	fmt.Fprintln(w)
+	_, err := w.Write(result.Data)
+	return err
+}
+
+// writeResultJSON writes result as a JSON object, with the data in data if it
+// is valid UTF-8 and in data_base64 otherwise.
+func writeResultJSON(w io.Writer, result *fnrun.Result) error {
+	out := struct {
+		Status     int               `json:"status"`
+		Env        map[string]string `json:"env"`
+		Data       *string           `json:"data,omitempty"`
+		DataBase64 *string           `json:"data_base64,omitempty"`
+	}{
+		Status: result.Status,
+		Env:    result.Env,
+	}
+	if out.Env == nil {
+		out.Env = map[string]string{}
+	}
+
+	if utf8.Valid(result.Data) {
+		data := string(result.Data)
+		out.Data = &data
+	} else {
+		data := base64.StdEncoding.EncodeToString(result.Data)
+		out.DataBase64 = &data
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(out)
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tessellator/fnrun/fnruntest"
+)
+
+func TestRunInvoke(t *testing.T) {
+	os.Setenv(fnruntest.SubprocessEnvVar, "1")
+	defer os.Unsetenv(fnruntest.SubprocessEnvVar)
+
+	stdin := strings.NewReader("world")
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+
+	code := run([]string{"invoke", "-env", "GREETING=Hello", os.Args[0], "-test.run=^TestGreetingFunction$"}, stdin, stdout, stderr)
+
+	if code != 0 {
+		t.Fatalf("Expected exit code 0, but got: %d\n%s", code, stderr)
+	}
+
+	want := "Status: 200\nEnv: A=b\nEnv: Content-Type=text/plain\n\nHello, world!"
+	if got := stdout.String(); got != want {
+		t.Errorf("Did not print expected result: got %q; want %q", got, want)
+	}
+}
+
+func TestRunInvoke_inputFileAndJSON(t *testing.T) {
+	os.Setenv(fnruntest.SubprocessEnvVar, "1")
+	defer os.Unsetenv(fnruntest.SubprocessEnvVar)
+
+	dir, err := ioutil.TempDir("", "fnrun")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "input")
+	if err := ioutil.WriteFile(path, []byte("file"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+
+	code := run([]string{"invoke", "-json", "-socket", "-input", path, os.Args[0], "-test.run=^TestGreetingFunction$"}, &bytes.Buffer{}, stdout, stderr)
+
+	if code != 0 {
+		t.Fatalf("Expected exit code 0, but got: %d\n%s", code, stderr)
+	}
+
+	var result struct {
+		Status int               `json:"status"`
+		Env    map[string]string `json:"env"`
+		Data   string            `json:"data"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &result); err != nil {
+		t.Fatalf("Output is not valid JSON: %+v\n%s", err, stdout)
+	}
+
+	if result.Status != 200 || result.Data != ", file!" || result.Env["A"] != "b" {
+		t.Errorf("Did not print expected result: %+v", result)
+	}
+}
+
+func TestRunInvoke_binaryJSON(t *testing.T) {
+	os.Setenv(fnruntest.SubprocessEnvVar, "1")
+	defer os.Unsetenv(fnruntest.SubprocessEnvVar)
+
+	stdout := &bytes.Buffer{}
+
+	code := run([]string{"invoke", "-json", os.Args[0], "-test.run=^TestBinaryFunction$"}, &bytes.Buffer{}, stdout, &bytes.Buffer{})
+
+	if code != 0 {
+		t.Fatalf("Expected exit code 0, but got: %d", code)
+	}
+
+	if !strings.Contains(stdout.String(), `"data_base64": "/wA="`) {
+		t.Errorf("Expected base64 data, but got: %s", stdout)
+	}
+}
+
+func TestRunInvoke_jsonlinesCodec(t *testing.T) {
+	script := `read -r event; read -r context; echo '{"status":201,"data":"hi"}'`
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+
+	code := run([]string{"invoke", "-codec", "jsonlines", "sh", "-c", script}, &bytes.Buffer{}, stdout, stderr)
+
+	if code != 0 {
+		t.Fatalf("Expected exit code 0, but got: %d\n%s", code, stderr)
+	}
+
+	if got := stdout.String(); got != "Status: 201\n\nhi" {
+		t.Errorf("Did not print expected result: got %q", got)
+	}
+}
+
+func TestRunInvoke_errors(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		wantCode int
+	}{
+		{"no command", []string{"invoke"}, 2},
+		{"invalid env", []string{"invoke", "-env", "NOVALUE", "true"}, 2},
+		{"unknown codec", []string{"invoke", "-codec", "xml", "true"}, 2},
+		{"missing input file", []string{"invoke", "-input", "does_not_exist", "true"}, 1},
+		{"missing executable", []string{"invoke", "does_not_exist"}, 1},
+		{"timeout", []string{"invoke", "-timeout", "50ms", "sleep", "5"}, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code := run(tt.args, &bytes.Buffer{}, &bytes.Buffer{}, &bytes.Buffer{})
+
+			if code != tt.wantCode {
+				t.Errorf("Expected exit code %d, but got: %d", tt.wantCode, code)
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+// Command fnrun runs functions that speak the fnrun protocol.
+//
+// Usage:
+//
+//	fnrun <command> [arguments]
+//
+// The commands are:
+//
+//	bench     measure the throughput and latency of a function in a pool
+//	invoke    invoke a function once and print the result
+//	serve     serve functions over HTTP as described by a configuration file
+//
+// Run "fnrun <command> -h" for the arguments of a command.
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// command is a subcommand of fnrun. It returns the exit status of the process.
+type command func(args []string, stdin io.Reader, stdout, stderr io.Writer) int
+
+var commands = map[string]command{
+	"bench":  runBench,
+	"invoke": runInvoke,
+	"serve":  runServe,
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		usage(stderr)
+		return 2
+	}
+
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(stderr, "fnrun: unknown command %q\n", args[0])
+		usage(stderr)
+		return 2
+	}
+
+	return cmd(args[1:], stdin, stdout, stderr)
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "usage: fnrun <command> [arguments]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "The commands are:")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "\tbench     measure the throughput and latency of a function in a pool")
+	fmt.Fprintln(w, "\tinvoke    invoke a function once and print the result")
+	fmt.Fprintln(w, "\tserve     serve functions over HTTP as described by a configuration file")
+}
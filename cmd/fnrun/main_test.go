@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/tessellator/fnrun"
+	"github.com/tessellator/fnrun/fnruntest"
+)
+
+func TestRun_usage(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{"no command", nil},
+		{"unknown command", []string{"frobnicate"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stderr := &bytes.Buffer{}
+
+			code := run(tt.args, &bytes.Buffer{}, &bytes.Buffer{}, stderr)
+
+			if code != 2 {
+				t.Errorf("Expected exit code 2, but got: %d", code)
+			}
+
+			if !strings.Contains(stderr.String(), "usage: fnrun") {
+				t.Errorf("Expected usage, but got: %s", stderr)
+			}
+		})
+	}
+}
+
+// syncBuffer is a bytes.Buffer that is safe for concurrent use, for capturing
+// the stderr of several functions at once.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// ---
+// Following are functions run as subprocesses by the tests of the commands.
+
+func TestGreetingFunction(t *testing.T) {
+	fnruntest.ServeSubprocess(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		env, _ := fnrun.Env(ctx)
+		return &fnrun.Result{
+			Status: 200,
+			Data:   []byte(env["GREETING"] + ", " + string(input.Data) + "!"),
+			Env:    map[string]string{"Content-Type": "text/plain", "A": "b"},
+		}, nil
+	})
+}
+
+func TestLoggingFunction(t *testing.T) {
+	fnruntest.ServeSubprocess(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		fmt.Fprintln(os.Stderr, "function log")
+		return &fnrun.Result{}, nil
+	})
+}
+
+func TestBinaryFunction(t *testing.T) {
+	fnruntest.ServeSubprocess(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		return &fnrun.Result{Data: []byte{0xff, 0x00}}, nil
+	})
+}
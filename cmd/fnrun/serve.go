@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/tessellator/fnrun"
+	"gopkg.in/yaml.v2"
+)
+
+// serveConfig is the configuration file of the serve command. Since JSON is a
+// subset of YAML, it may be written in either format.
+type serveConfig struct {
+	// Address is the address to listen on for HTTP requests.
+	Address string `yaml:"address"`
+
+	// ShutdownTimeout is how long to wait for in-flight requests to complete
+	// when shutting down.
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+
+	Functions []functionConfig `yaml:"functions"`
+}
+
+// functionConfig describes a function served by the serve command.
+type functionConfig struct {
+	Name            string            `yaml:"name"`
+	Command         string            `yaml:"command"`
+	Args            []string          `yaml:"args"`
+	Env             map[string]string `yaml:"env"`
+	Dir             string            `yaml:"dir"`
+	PoolSize        int               `yaml:"pool_size"`
+	MaxWaitDuration time.Duration     `yaml:"max_wait_duration"`
+	MaxRunnableTime time.Duration     `yaml:"max_runnable_time"`
+
+	// HTTPPath is the path of the HTTP trigger. As with http.ServeMux, a path
+	// that ends in a slash matches every path below it.
+	HTTPPath string `yaml:"http_path"`
+}
+
+func runServe(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("fnrun serve", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	configPath := flags.String("config", "", "path to the YAML or JSON configuration file")
+	address := flags.String("addr", "", "address to listen on, overriding the configuration file")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: fnrun serve -config file [-addr address]")
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *configPath == "" || flags.NArg() > 0 {
+		flags.Usage()
+		return 2
+	}
+
+	config, err := loadServeConfig(*configPath)
+	if err != nil {
+		fmt.Fprintf(stderr, "fnrun serve: %v\n", err)
+		return 1
+	}
+	if *address != "" {
+		config.Address = *address
+	}
+
+	listener, err := net.Listen("tcp", config.Address)
+	if err != nil {
+		fmt.Fprintf(stderr, "fnrun serve: %v\n", err)
+		return 1
+	}
+	fmt.Fprintf(stderr, "fnrun serve: listening on %s\n", listener.Addr())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	defer signal.Stop(signals)
+	go func() {
+		select {
+		case <-signals:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	err = serve(ctx, config, listener, stderr)
+	if err != nil {
+		fmt.Fprintf(stderr, "fnrun serve: %v\n", err)
+		return 1
+	}
+
+	return 0
+}
+
+// loadServeConfig reads the configuration file at path, applies defaults and
+// validates it.
+func loadServeConfig(path string) (*serveConfig, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &serveConfig{}
+	err = yaml.UnmarshalStrict(b, config)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.Address == "" {
+		config.Address = ":8080"
+	}
+	if config.ShutdownTimeout == 0 {
+		config.ShutdownTimeout = 30 * time.Second
+	}
+
+	if len(config.Functions) == 0 {
+		return nil, errors.New("no functions are configured")
+	}
+
+	paths := make(map[string]string)
+	for i := range config.Functions {
+		fn := &config.Functions[i]
+
+		if fn.Name == "" {
+			return nil, fmt.Errorf("function %d has no name", i+1)
+		}
+		if fn.Command == "" {
+			return nil, fmt.Errorf("function %s has no command", fn.Name)
+		}
+		if !strings.HasPrefix(fn.HTTPPath, "/") {
+			return nil, fmt.Errorf("function %s has an invalid http_path: %q", fn.Name, fn.HTTPPath)
+		}
+		if other, ok := paths[fn.HTTPPath]; ok {
+			return nil, fmt.Errorf("functions %s and %s have the same http_path", other, fn.Name)
+		}
+		paths[fn.HTTPPath] = fn.Name
+
+		if fn.PoolSize == 0 {
+			fn.PoolSize = 1
+		}
+		if fn.MaxWaitDuration == 0 {
+			fn.MaxWaitDuration = time.Second
+		}
+		if fn.MaxRunnableTime == 0 {
+			fn.MaxRunnableTime = 30 * time.Second
+		}
+	}
+
+	return config, nil
+}
+
+// serve creates a pool for each function and serves HTTP requests on listener
+// until ctx is done. It then stops accepting requests, waits up to the
+// shutdown timeout for in-flight requests to complete, and closes the pools.
+func serve(ctx context.Context, config *serveConfig, listener net.Listener, stderr io.Writer) error {
+	var pools []*fnrun.InvokerPool
+	defer func() {
+		for _, pool := range pools {
+			pool.Close()
+		}
+	}()
+
+	mux := http.NewServeMux()
+	for _, fn := range config.Functions {
+		pool, err := newFunctionPool(fn, stderr)
+		if err != nil {
+			listener.Close()
+			return fmt.Errorf("starting function %s: %v", fn.Name, err)
+		}
+		pools = append(pools, pool)
+
+		mux.Handle(fn.HTTPPath, fnrun.NewHTTPHandler(pool))
+	}
+
+	server := &http.Server{Handler: mux}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- server.Serve(listener)
+	}()
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), config.ShutdownTimeout)
+	defer cancel()
+
+	return server.Shutdown(shutdownCtx)
+}
+
+// newFunctionPool creates a pool of processes for fn whose stderr is written
+// to stderr. Unless stderr is an *os.File, it must be safe for concurrent use
+// because the processes write to it concurrently.
+func newFunctionPool(fn functionConfig, stderr io.Writer) (*fnrun.InvokerPool, error) {
+	config := fnrun.InvokerPoolConfig{
+		MaxInvokerCount: fn.PoolSize,
+		InvokerFactory:  &functionInvokerFactory{fn: fn, stderr: stderr},
+		MaxWaitDuration: fn.MaxWaitDuration,
+		MaxRunnableTime: fn.MaxRunnableTime,
+	}
+
+	return fnrun.NewInvokerPool(config)
+}
+
+// functionInvokerFactory starts a process for each Invoker of a function so
+// that the stderr of fnrun can be given to it.
+type functionInvokerFactory struct {
+	fn     functionConfig
+	stderr io.Writer
+}
+
+func (factory *functionInvokerFactory) NewInvoker() (fnrun.Invoker, error) {
+	fn := factory.fn
+
+	cmd := exec.Command(fn.Command, fn.Args...)
+	cmd.Dir = fn.Dir
+	cmd.Env = os.Environ()
+	for k, v := range fn.Env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+	cmd.Stderr = factory.stderr
+
+	return fnrun.NewCmdInvoker(cmd)
+}
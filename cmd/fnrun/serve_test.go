@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tessellator/fnrun/fnruntest"
+)
+
+// writeConfig writes content to a temporary file whose name ends with name.
+// The caller removes the file.
+func writeConfig(t *testing.T, name, content string) string {
+	f, err := ioutil.TempFile("", "*-"+name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if _, err := f.WriteString(content); err != nil {
+		t.Fatal(err)
+	}
+	return f.Name()
+}
+
+func TestLoadServeConfig(t *testing.T) {
+	yamlConfig := `
+address: 127.0.0.1:9000
+functions:
+  - name: greeter
+    command: greeter
+    args: [--loud]
+    env:
+      GREETING: Hello
+    pool_size: 4
+    max_wait_duration: 250ms
+    max_runnable_time: 5s
+    http_path: /greet
+  - name: echo
+    command: cat
+    http_path: /echo/
+`
+	jsonConfig := `{
+  "address": "127.0.0.1:9000",
+  "functions": [
+    {"name": "greeter", "command": "greeter", "args": ["--loud"], "env": {"GREETING": "Hello"},
+     "pool_size": 4, "max_wait_duration": "250ms", "max_runnable_time": "5s", "http_path": "/greet"},
+    {"name": "echo", "command": "cat", "http_path": "/echo/"}
+  ]
+}`
+
+	for name, content := range map[string]string{"fnrun.yaml": yamlConfig, "fnrun.json": jsonConfig} {
+		t.Run(name, func(t *testing.T) {
+			path := writeConfig(t, name, content)
+			defer os.Remove(path)
+
+			config, err := loadServeConfig(path)
+
+			if err != nil {
+				t.Fatalf("loadServeConfig() returned err: %+v", err)
+			}
+
+			if config.Address != "127.0.0.1:9000" || config.ShutdownTimeout != 30*time.Second {
+				t.Errorf("Did not load expected server settings: %+v", config)
+			}
+
+			greeter := config.Functions[0]
+			if greeter.Args[0] != "--loud" || greeter.Env["GREETING"] != "Hello" || greeter.PoolSize != 4 ||
+				greeter.MaxWaitDuration != 250*time.Millisecond || greeter.MaxRunnableTime != 5*time.Second {
+				t.Errorf("Did not load expected function settings: %+v", greeter)
+			}
+
+			echo := config.Functions[1]
+			if echo.PoolSize != 1 || echo.MaxWaitDuration != time.Second || echo.MaxRunnableTime != 30*time.Second {
+				t.Errorf("Did not apply expected defaults: %+v", echo)
+			}
+		})
+	}
+}
+
+func TestLoadServeConfig_invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"no functions", "address: :8080\n"},
+		{"missing name", "functions:\n  - command: cat\n    http_path: /\n"},
+		{"missing command", "functions:\n  - name: echo\n    http_path: /\n"},
+		{"invalid path", "functions:\n  - name: echo\n    command: cat\n    http_path: echo\n"},
+		{"duplicate path", "functions:\n  - {name: a, command: cat, http_path: /}\n  - {name: b, command: cat, http_path: /}\n"},
+		{"unknown field", "functions:\n  - {name: a, command: cat, http_path: /, pool: 2}\n"},
+		{"invalid duration", "functions:\n  - {name: a, command: cat, http_path: /, max_wait_duration: soon}\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeConfig(t, "fnrun.yaml", tt.content)
+			defer os.Remove(path)
+
+			_, err := loadServeConfig(path)
+
+			if err == nil {
+				t.Errorf("loadServeConfig() did not return error")
+			}
+		})
+	}
+}
+
+func TestServe(t *testing.T) {
+	config := &serveConfig{
+		ShutdownTimeout: 5 * time.Second,
+		Functions: []functionConfig{{
+			Name:            "greeter",
+			Command:         os.Args[0],
+			Args:            []string{"-test.run=^TestGreetingFunction$"},
+			Env:             map[string]string{fnruntest.SubprocessEnvVar: "1"},
+			PoolSize:        2,
+			MaxWaitDuration: time.Second,
+			MaxRunnableTime: 10 * time.Second,
+			HTTPPath:        "/greet",
+		}},
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- serve(ctx, config, listener, ioutil.Discard)
+	}()
+
+	url := "http://" + listener.Addr().String()
+	resp, err := http.Post(url+"/greet", "text/plain", strings.NewReader("world"))
+	if err != nil {
+		t.Fatalf("Request returned err: %+v", err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK || string(body) != ", world!" {
+		t.Errorf("Did not receive expected response: %d %s", resp.StatusCode, body)
+	}
+
+	resp, err = http.Get(url + "/other")
+	if err != nil {
+		t.Fatalf("Request returned err: %+v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unconfigured path, but got: %d", resp.StatusCode)
+	}
+
+	cancel()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("serve() returned err: %+v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("serve() did not return after shutdown")
+	}
+}
+
+func TestServe_invalidCommand(t *testing.T) {
+	config := &serveConfig{
+		Functions: []functionConfig{{
+			Name:            "missing",
+			Command:         "does_not_exist",
+			PoolSize:        1,
+			MaxWaitDuration: time.Second,
+			MaxRunnableTime: time.Second,
+			HTTPPath:        "/",
+		}},
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = serve(context.Background(), config, listener, &bytes.Buffer{})
+
+	if err == nil {
+		t.Errorf("serve() did not return error")
+	}
+}
+
+func TestRunServe_usage(t *testing.T) {
+	code := run([]string{"serve"}, &bytes.Buffer{}, &bytes.Buffer{}, &bytes.Buffer{})
+
+	if code != 2 {
+		t.Errorf("Expected exit code 2, but got: %d", code)
+	}
+}
@@ -1,19 +1,60 @@
 package fnrun
 
 import (
+	"bufio"
 	"context"
 	"io"
+	"os"
 	"os/exec"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/tessellator/executil"
 )
 
+// closeGracePeriod is how long Close waits for a process to exit after its
+// stdin is closed before the process is killed.
+const closeGracePeriod = 5 * time.Second
+
+// SocketFDEnvVar is the name of the environment variable that tells a function
+// process which file descriptor carries the protocol stream when the
+// SocketTransport is used.
+const SocketFDEnvVar = "FNRUN_SOCKET_FD"
+
+// Transport identifies how a runner and a function process exchange protocol
+// messages.
+type Transport int
+
+const (
+	// StdioTransport exchanges protocol messages over the stdin and stdout of
+	// the function process.
+	StdioTransport Transport = iota
+
+	// SocketTransport exchanges protocol messages over a Unix domain socket
+	// inherited by the function process, leaving its stdout free for logging.
+	// The file descriptor of the socket is given by the FNRUN_SOCKET_FD
+	// environment variable. It is only supported on Unix systems.
+	SocketTransport
+)
+
+// CmdInvokerConfig contains the configuration data for invokers created by
+// NewCmdInvokerWithConfig and NewCmdInvokerFactoryWithConfig.
+type CmdInvokerConfig struct {
+	Transport Transport
+
+	// Codec encodes the messages exchanged with the function. If nil,
+	// ProtobufCodec is used.
+	Codec Codec
+}
+
 type cmdInvoker struct {
 	cmd             *exec.Cmd
+	codec           Codec
 	stdin           io.WriteCloser
-	stdout          io.ReadCloser
+	stdout          io.Reader
 	maxRunnableTime time.Duration
+	closeOnce       sync.Once
 }
 
 // NewCmdInvoker creates an object that can invoke the provided exec.Cmd.
@@ -25,45 +66,120 @@ type cmdInvoker struct {
 // This object kills the OS process managed by the provided cmd when an
 // invocation fails, so the object returned from this function should not be
 // reused if a call to Invoke returns an error.
+//
+// The returned object also implements io.Closer; calling Close terminates the
+// OS process and releases its resources.
 func NewCmdInvoker(cmd *exec.Cmd) (Invoker, error) {
-	stdin, err := cmd.StdinPipe()
-	if err != nil {
-		return nil, err
+	return NewCmdInvokerWithConfig(cmd, CmdInvokerConfig{})
+}
+
+// NewCmdInvokerWithConfig creates an object that can invoke the provided
+// exec.Cmd using the provided configuration.
+//
+// With the SocketTransport, the stdin and stdout of the cmd are left as
+// configured by the caller, so the function may write logs to stdout.
+//
+// See NewCmdInvoker for details on the ownership of cmd and the returned
+// object.
+func NewCmdInvokerWithConfig(cmd *exec.Cmd, config CmdInvokerConfig) (Invoker, error) {
+	var stdin io.WriteCloser
+	var stdout io.ReadCloser
+	var socket io.Closer
+
+	switch config.Transport {
+	case SocketTransport:
+		local, remote, err := socketpair()
+		if err != nil {
+			return nil, err
+		}
+		// The process inherits its own copy of remote when it starts.
+		defer remote.Close()
+
+		fd := appendExtraFile(cmd, remote)
+		appendEnv(cmd, SocketFDEnvVar+"="+strconv.Itoa(fd))
+		stdin, stdout, socket = local, local, local
+	default:
+		var err error
+		stdin, err = cmd.StdinPipe()
+		if err != nil {
+			return nil, err
+		}
+
+		stdout, err = cmd.StdoutPipe()
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	stdout, err := cmd.StdoutPipe()
+	err := cmd.Start()
 	if err != nil {
+		if socket != nil {
+			socket.Close()
+		}
 		return nil, err
 	}
 
-	err = cmd.Start()
-	if err != nil {
-		return nil, err
+	codec := config.Codec
+	if codec == nil {
+		codec = ProtobufCodec
 	}
 
 	p := &cmdInvoker{
 		cmd:    cmd,
+		codec:  codec,
 		stdin:  stdin,
-		stdout: stdout,
+		stdout: bufio.NewReader(stdout),
 	}
 
 	return p, nil
 }
 
+// appendEnv adds the key=value pair kv to the environment of cmd. Like
+// exec.Cmd, a nil environment is treated as the environment of the current
+// process. The environment is copied so that a slice shared with other
+// commands, such as those cloned by a factory, is not modified.
+func appendEnv(cmd *exec.Cmd, kv string) {
+	env := cmd.Env
+	if env == nil {
+		env = os.Environ()
+	}
+	cmd.Env = append(env[:len(env):len(env)], kv)
+}
+
+// appendExtraFile adds f to the files inherited by cmd and returns the file
+// descriptor f will have in the new process. The slice is copied so that a
+// slice shared with other commands is not modified.
+func appendExtraFile(cmd *exec.Cmd, f *os.File) int {
+	n := len(cmd.ExtraFiles)
+	cmd.ExtraFiles = append(cmd.ExtraFiles[:n:n], f)
+	return 3 + n
+}
+
 func (cf *cmdInvoker) Invoke(ctx context.Context, input *Input) (*Result, error) {
+	kill := func() { cf.cmd.Process.Kill() }
+	return invokeStream(ctx, cf.codec, input, cf.stdin, cf.stdout, kill)
+}
+
+// invokeStream performs an invocation by writing the input and execution
+// context to w and reading the result from r, using codec to encode them.
+//
+// The kill function is called if the invocation fails or the context is done
+// before a result is read; it must terminate the function and cause any
+// pending read from r to return.
+func invokeStream(ctx context.Context, codec Codec, input *Input, w io.Writer, r io.Reader, kill func()) (*Result, error) {
 	if _, hasTimeout := ctx.Deadline(); !hasTimeout {
 		return nil, ErrMissingTimeout
 	}
 
-	_, err := input.WriteTo(cf.stdin)
+	_, err := codec.WriteEvent(w, input)
 	if err != nil {
-		cf.cmd.Process.Kill()
+		kill()
 		return nil, err
 	}
 
-	_, err = WriteTo(ctx, cf.stdin)
+	_, err = codec.WriteExecutionContext(ctx, w)
 	if err != nil {
-		cf.cmd.Process.Kill()
+		kill()
 		return nil, err
 	}
 
@@ -72,7 +188,7 @@ func (cf *cmdInvoker) Invoke(ctx context.Context, input *Input) (*Result, error)
 
 	go func() {
 		result := &Result{}
-		err := ReadFrom(cf.stdout, result)
+		err := codec.ReadResult(r, result)
 		if err != nil {
 			errChan <- err
 			return
@@ -84,16 +200,46 @@ func (cf *cmdInvoker) Invoke(ctx context.Context, input *Input) (*Result, error)
 	case response := <-resultChan:
 		return response, nil
 	case <-ctx.Done():
-		cf.cmd.Process.Kill()
+		kill()
 		return nil, ctx.Err()
 	case err = <-errChan:
-		cf.cmd.Process.Kill()
+		kill()
 		return nil, err
 	}
 }
 
+// Close terminates the OS process managed by the invoker.
+//
+// The stdin of the process is closed first so that a well-behaved function can
+// exit on its own. If it has not exited within closeGracePeriod, it is killed.
+func (cf *cmdInvoker) Close() error {
+	cf.closeOnce.Do(func() {
+		cf.stdin.Close()
+
+		done := make(chan struct{})
+		go func() {
+			cf.cmd.Wait()
+			close(done)
+		}()
+
+		select {
+		case <-done:
+		case <-time.After(closeGracePeriod):
+			cf.cmd.Process.Kill()
+			<-done
+		}
+	})
+
+	return nil
+}
+
+func (cf *cmdInvoker) residentSetSize() (int64, error) {
+	return readRSS(cf.cmd.Process.Pid)
+}
+
 type cmdInvokerFactory struct {
-	cmd *exec.Cmd
+	cmd    *exec.Cmd
+	config CmdInvokerConfig
 }
 
 // NewCmdInvokerFactory creates a factory that can create new instances of
@@ -105,7 +251,20 @@ func NewCmdInvokerFactory(cmd *exec.Cmd) InvokerFactory {
 	return &cmdInvokerFactory{cmd: cmd}
 }
 
+// NewCmdInvokerFactoryWithConfig creates a factory that can create new
+// instances of CmdInvoker instances using the provided configuration.
+//
+// With the SocketTransport, the Stdout and Stderr of cmd are given to each new
+// process so that the function can log to them.
+func NewCmdInvokerFactoryWithConfig(cmd *exec.Cmd, config CmdInvokerConfig) InvokerFactory {
+	return &cmdInvokerFactory{cmd: cmd, config: config}
+}
+
 func (factory *cmdInvokerFactory) NewInvoker() (Invoker, error) {
 	newCmd := executil.CloneCmd(factory.cmd)
-	return NewCmdInvoker(newCmd)
+	if factory.config.Transport == SocketTransport {
+		newCmd.Stdout = factory.cmd.Stdout
+		newCmd.Stderr = factory.cmd.Stderr
+	}
+	return NewCmdInvokerWithConfig(newCmd, factory.config)
 }
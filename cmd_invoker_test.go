@@ -1,9 +1,17 @@
 package fnrun
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
 	"os"
 	"os/exec"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -141,6 +149,27 @@ func TestCmdInvoker_Invoke_validReturn(t *testing.T) {
 	}
 }
 
+func TestCmdInvoker_Close(t *testing.T) {
+	cmd := exec.Command(os.Args[0], "-test.run=Test_GreetingSubprocess")
+	cmd.Env = append(os.Environ(), "GO_RUNNING_SUBPROCESS=1")
+
+	invoker, err := NewCmdInvoker(cmd)
+
+	if err != nil {
+		t.Fatalf("NewCmdInvoker() returned error: %+v", err)
+	}
+
+	err = invoker.(io.Closer).Close()
+
+	if err != nil {
+		t.Errorf("Close() returned error: %+v", err)
+	}
+
+	if cmd.ProcessState == nil {
+		t.Errorf("Close() returned before the process exited")
+	}
+}
+
 func TestNewCmdInvokerFactory(t *testing.T) {
 	cmd := exec.Command(os.Args[0], "-test.run=Test_GreetingSubprocess")
 	cmd.Env = append(os.Environ(), "GO_RUNNING_SUBPROCESS=1")
@@ -181,6 +210,123 @@ func TestNewCmdInvokerFactory(t *testing.T) {
 	}
 }
 
+func TestNewCmdInvokerWithConfig_socketTransport(t *testing.T) {
+	var stdout bytes.Buffer
+	cmd := exec.Command(os.Args[0], "-test.run=Test_SocketGreetingSubprocess")
+	cmd.Env = append(os.Environ(), "GO_RUNNING_SUBPROCESS=1")
+	cmd.Stdout = &stdout
+
+	invoker, err := NewCmdInvokerWithConfig(cmd, CmdInvokerConfig{Transport: SocketTransport})
+
+	if err != nil {
+		t.Fatalf("NewCmdInvokerWithConfig() returned error: %+v", err)
+	}
+
+	for _, name := range []string{"world", "again"} {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		result, err := invoker.Invoke(ctx, &Input{Data: []byte(name)})
+
+		if err != nil {
+			t.Fatalf("Invoke() returned err: %+v", err)
+		}
+
+		want := "Hello, " + name + "!"
+		if got := string(result.Data); got != want {
+			t.Errorf("Did not read expected result: got %s; want %s", got, want)
+		}
+	}
+
+	invoker.(io.Closer).Close()
+
+	if !strings.Contains(stdout.String(), "greeting world") {
+		t.Errorf("Expected function logs on stdout, but got: %q", stdout.String())
+	}
+}
+
+func TestNewCmdInvokerFactoryWithConfig(t *testing.T) {
+	cmd := exec.Command(os.Args[0], "-test.run=Test_SocketGreetingSubprocess")
+	cmd.Env = append(os.Environ(), "GO_RUNNING_SUBPROCESS=1")
+
+	factory := NewCmdInvokerFactoryWithConfig(cmd, CmdInvokerConfig{Transport: SocketTransport})
+
+	for i := 0; i < 2; i++ {
+		invoker, err := factory.NewInvoker()
+
+		if err != nil {
+			t.Fatalf("NewInvoker() returned error: %+v", err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		result, err := invoker.Invoke(ctx, &Input{Data: []byte("world")})
+
+		if err != nil {
+			t.Fatalf("Invoke() returned err: %+v", err)
+		}
+
+		if got := string(result.Data); got != "Hello, world!" {
+			t.Errorf("Did not read expected result: got %s; want Hello, world!", got)
+		}
+
+		invoker.(io.Closer).Close()
+	}
+}
+
+func TestNewCmdInvokerWithConfig_jsonLinesCodec(t *testing.T) {
+	t.Run("with a shell script", func(t *testing.T) {
+		script := `while read -r event && read -r context; do echo '{"status":201,"data":"hi"}'; done`
+		cmd := exec.Command("sh", "-c", script)
+
+		invoker, err := NewCmdInvokerWithConfig(cmd, CmdInvokerConfig{Codec: JSONLinesCodec})
+		if err != nil {
+			t.Fatalf("NewCmdInvokerWithConfig() returned error: %+v", err)
+		}
+		defer invoker.(io.Closer).Close()
+
+		for i := 0; i < 2; i++ {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			result, err := invoker.Invoke(ctx, &Input{Data: []byte("world")})
+			cancel()
+
+			if err != nil {
+				t.Fatalf("Invoke() returned err: %+v", err)
+			}
+
+			if result.Status != 201 || string(result.Data) != "hi" {
+				t.Errorf("Did not read expected result: %+v", result)
+			}
+		}
+	})
+
+	t.Run("with binary data and env", func(t *testing.T) {
+		cmd := exec.Command(os.Args[0], "-test.run=Test_JSONGreetingSubprocess")
+		cmd.Env = append(os.Environ(), "GO_RUNNING_SUBPROCESS=1")
+
+		invoker, err := NewCmdInvokerWithConfig(cmd, CmdInvokerConfig{Codec: JSONLinesCodec})
+		if err != nil {
+			t.Fatalf("NewCmdInvokerWithConfig() returned error: %+v", err)
+		}
+		defer invoker.(io.Closer).Close()
+
+		ctx := WithEnv(context.Background(), map[string]string{"GREETING": "Hello"})
+		ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		defer cancel()
+
+		result, err := invoker.Invoke(ctx, &Input{Data: []byte{0xff}})
+
+		if err != nil {
+			t.Fatalf("Invoke() returned err: %+v", err)
+		}
+
+		if want := "Hello, \xff!"; string(result.Data) != want {
+			t.Errorf("Did not read expected result: got %q; want %q", result.Data, want)
+		}
+	})
+}
+
 // -----------------------------------------------------------------------------
 // Following are various subprocesses used for testing. Each is named according
 // to its behavior.
@@ -236,3 +382,53 @@ func Test_GreetingSubprocess(t *testing.T) {
 	result := protobufs.Result{Data: []byte(response)}
 	protoio.Write(os.Stdout, &result)
 }
+
+func Test_SocketGreetingSubprocess(t *testing.T) {
+	if os.Getenv("GO_RUNNING_SUBPROCESS") != "1" {
+		return
+	}
+
+	fd, _ := strconv.Atoi(os.Getenv(SocketFDEnvVar))
+	conn := os.NewFile(uintptr(fd), "fnrun")
+
+	for {
+		ctx := protobufs.ExecutionContext{}
+		event := protobufs.Event{}
+
+		if err := protoio.Read(conn, &event); err != nil {
+			return
+		}
+		protoio.Read(conn, &ctx)
+
+		fmt.Println("greeting " + string(event.GetData()))
+
+		response := "Hello, " + string(event.GetData()) + "!"
+		result := protobufs.Result{Data: []byte(response)}
+		protoio.Write(conn, &result)
+	}
+}
+
+func Test_JSONGreetingSubprocess(t *testing.T) {
+	if os.Getenv("GO_RUNNING_SUBPROCESS") != "1" {
+		return
+	}
+
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		var event struct {
+			DataBase64 string `json:"data_base64"`
+		}
+		json.Unmarshal(scanner.Bytes(), &event)
+		data, _ := base64.StdEncoding.DecodeString(event.DataBase64)
+
+		scanner.Scan()
+		var execCtx struct {
+			Env map[string]string `json:"env"`
+		}
+		json.Unmarshal(scanner.Bytes(), &execCtx)
+
+		response := execCtx.Env["GREETING"] + ", " + string(data) + "!"
+		out, _ := json.Marshal(map[string]string{"data_base64": base64.StdEncoding.EncodeToString([]byte(response))})
+		fmt.Println(string(out))
+	}
+}
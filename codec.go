@@ -0,0 +1,254 @@
+package fnrun
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"time"
+	"unicode/utf8"
+
+	tspb "github.com/golang/protobuf/ptypes"
+	"github.com/tessellator/fnrun/fnrun/protobufs"
+	"github.com/tessellator/protoio"
+)
+
+// Codec encodes the messages that a runner exchanges with a function.
+//
+// For each invocation, the runner writes an event containing the Input and then
+// the execution context, and reads a result.
+type Codec interface {
+	// WriteEvent writes the Input to w.
+	WriteEvent(w io.Writer, input *Input) (int64, error)
+
+	// WriteExecutionContext writes the environment variables and deadline of
+	// ctx to w. It returns ErrMissingTimeout if ctx does not have a deadline.
+	WriteExecutionContext(ctx context.Context, w io.Writer) (int64, error)
+
+	// ReadResult reads a Result from r and populates result.
+	ReadResult(r io.Reader, result *Result) error
+}
+
+// ProtobufCodec is the default Codec. Each message is a protobuf message from
+// the fnrun.protobuf package, prefixed by its length as a big-endian 32-bit
+// integer.
+var ProtobufCodec Codec = protobufCodec{}
+
+// JSONLinesCodec is a Codec that writes each message as a JSON object on a
+// single line, which makes it possible to write functions with tools such as
+// a shell and jq.
+//
+// An event is written as {"data": "..."} when the data is valid UTF-8 and as
+// {"data_base64": "..."} otherwise. An execution context is written as
+// {"env": {...}, "stop_time": "..."}, with the stop time in RFC 3339 format.
+// A result is read from a line of the form {"status": 200, "env": {...},
+// "data": "..."}, where data_base64 may be used in place of data and any field
+// may be omitted. Blank lines before a result are ignored.
+var JSONLinesCodec Codec = jsonLinesCodec{}
+
+type protobufCodec struct{}
+
+func (protobufCodec) WriteEvent(w io.Writer, input *Input) (int64, error) {
+	pInput := protobufs.Event{
+		Data: input.Data,
+	}
+
+	return protoio.Write(w, &pInput)
+}
+
+func (protobufCodec) WriteExecutionContext(ctx context.Context, w io.Writer) (int64, error) {
+	envVars := []*protobufs.EnvironmentVariable{}
+	env, hasEnv := Env(ctx)
+	if hasEnv {
+		for k, v := range env {
+			envVars = append(envVars, &protobufs.EnvironmentVariable{Name: k, Value: v})
+		}
+	}
+
+	stopTime, hasTimeout := ctx.Deadline()
+	if !hasTimeout {
+		return 0, ErrMissingTimeout
+	}
+	stopTimeProto, err := tspb.TimestampProto(stopTime)
+	if err != nil {
+		return 0, err
+	}
+
+	protoCtx := protobufs.ExecutionContext{
+		EnvVars:  envVars,
+		StopTime: stopTimeProto,
+	}
+
+	return protoio.Write(w, &protoCtx)
+}
+
+func (protobufCodec) ReadResult(r io.Reader, result *Result) error {
+	pResult := protobufs.Result{}
+	err := protoio.Read(r, &pResult)
+	if err != nil {
+		return err
+	}
+
+	env := make(map[string]string)
+	for _, envVar := range pResult.GetEnvVars() {
+		env[envVar.GetName()] = envVar.GetValue()
+	}
+
+	result.Status = int(pResult.GetStatus())
+	result.Data = pResult.GetData()
+	result.Env = env
+
+	return nil
+}
+
+type jsonLinesCodec struct{}
+
+// jsonLine is the union of the messages written and read by JSONLinesCodec.
+type jsonLine struct {
+	Status     int               `json:"status,omitempty"`
+	Env        map[string]string `json:"env,omitempty"`
+	Data       *string           `json:"data,omitempty"`
+	DataBase64 *string           `json:"data_base64,omitempty"`
+	StopTime   string            `json:"stop_time,omitempty"`
+}
+
+func (jsonLinesCodec) WriteEvent(w io.Writer, input *Input) (int64, error) {
+	line := jsonLine{}
+	if utf8.Valid(input.Data) {
+		data := string(input.Data)
+		line.Data = &data
+	} else {
+		data := base64.StdEncoding.EncodeToString(input.Data)
+		line.DataBase64 = &data
+	}
+
+	return writeJSONLine(w, line)
+}
+
+func (jsonLinesCodec) WriteExecutionContext(ctx context.Context, w io.Writer) (int64, error) {
+	stopTime, hasTimeout := ctx.Deadline()
+	if !hasTimeout {
+		return 0, ErrMissingTimeout
+	}
+
+	env, _ := Env(ctx)
+	if env == nil {
+		env = map[string]string{}
+	}
+
+	// Env is written even when it is empty so that functions can rely on it.
+	line := struct {
+		Env      map[string]string `json:"env"`
+		StopTime string            `json:"stop_time"`
+	}{
+		Env:      env,
+		StopTime: stopTime.UTC().Format(time.RFC3339Nano),
+	}
+
+	return writeJSONLine(w, line)
+}
+
+func (jsonLinesCodec) ReadResult(r io.Reader, result *Result) error {
+	var text []byte
+	for len(text) == 0 {
+		var err error
+		text, err = readLine(r)
+		if err != nil {
+			return err
+		}
+	}
+
+	line := jsonLine{}
+	err := json.Unmarshal(text, &line)
+	if err != nil {
+		return err
+	}
+
+	var data []byte
+	switch {
+	case line.DataBase64 != nil:
+		data, err = base64.StdEncoding.DecodeString(*line.DataBase64)
+		if err != nil {
+			return err
+		}
+	case line.Data != nil:
+		data = []byte(*line.Data)
+	}
+
+	env := line.Env
+	if env == nil {
+		env = make(map[string]string)
+	}
+
+	result.Status = line.Status
+	result.Data = data
+	result.Env = env
+
+	return nil
+}
+
+func writeJSONLine(w io.Writer, v interface{}) (int64, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := w.Write(append(b, '\n'))
+	return int64(n), err
+}
+
+// readLine reads a line from r and returns it without the line terminator.
+// Unless r is buffered, it is read a byte at a time so that nothing past the
+// end of the line is consumed.
+func readLine(r io.Reader) ([]byte, error) {
+	if br, ok := r.(*bufio.Reader); ok {
+		line, err := br.ReadBytes('\n')
+		return trimLine(line, err)
+	}
+
+	br, ok := r.(io.ByteReader)
+	if !ok {
+		br = &singleByteReader{r: r}
+	}
+
+	var line []byte
+	for {
+		b, err := br.ReadByte()
+		if err != nil {
+			return trimLine(line, err)
+		}
+		line = append(line, b)
+		if b == '\n' {
+			return trimLine(line, nil)
+		}
+	}
+}
+
+// trimLine removes the line terminator from line. A final line without a
+// terminator is an unexpected EOF.
+func trimLine(line []byte, err error) ([]byte, error) {
+	if err == io.EOF && len(line) > 0 {
+		return nil, io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	line = line[:len(line)-1]
+	if n := len(line); n > 0 && line[n-1] == '\r' {
+		line = line[:n-1]
+	}
+	return line, nil
+}
+
+// singleByteReader adapts an io.Reader to io.ByteReader without buffering.
+type singleByteReader struct {
+	r   io.Reader
+	buf [1]byte
+}
+
+func (sbr *singleByteReader) ReadByte() (byte, error) {
+	_, err := io.ReadFull(sbr.r, sbr.buf[:])
+	return sbr.buf[0], err
+}
@@ -0,0 +1,171 @@
+package fnrun
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJSONLinesCodec_WriteEvent(t *testing.T) {
+	tests := []struct {
+		data []byte
+		want string
+	}{
+		{[]byte("hello"), `{"data":"hello"}` + "\n"},
+		{[]byte{0xff, 0x00}, `{"data_base64":"/wA="}` + "\n"},
+		{nil, `{"data":""}` + "\n"},
+	}
+
+	for _, tt := range tests {
+		buf := &bytes.Buffer{}
+		_, err := JSONLinesCodec.WriteEvent(buf, &Input{Data: tt.data})
+
+		if err != nil {
+			t.Fatalf("WriteEvent() returned err: %+v", err)
+		}
+
+		if got := buf.String(); got != tt.want {
+			t.Errorf("Did not write expected event: got %s; want %s", got, tt.want)
+		}
+	}
+}
+
+func TestJSONLinesCodec_WriteExecutionContext(t *testing.T) {
+	stopTime := time.Date(2020, 9, 1, 12, 0, 0, 500, time.UTC)
+	ctx := WithEnv(context.Background(), map[string]string{"GREETING": "Hello"})
+	ctx, cancel := context.WithDeadline(ctx, stopTime)
+	defer cancel()
+
+	buf := &bytes.Buffer{}
+	_, err := JSONLinesCodec.WriteExecutionContext(ctx, buf)
+
+	if err != nil {
+		t.Fatalf("WriteExecutionContext() returned err: %+v", err)
+	}
+
+	want := `{"env":{"GREETING":"Hello"},"stop_time":"2020-09-01T12:00:00.0000005Z"}` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("Did not write expected execution context: got %s; want %s", got, want)
+	}
+}
+
+func TestCodec_WriteExecutionContext_missingTimeout(t *testing.T) {
+	for _, codec := range []Codec{ProtobufCodec, JSONLinesCodec} {
+		_, err := codec.WriteExecutionContext(context.Background(), &bytes.Buffer{})
+
+		if err != ErrMissingTimeout {
+			t.Errorf("Expected missing timeout error, but got: %+v", err)
+		}
+	}
+}
+
+func TestJSONLinesCodec_ReadResult(t *testing.T) {
+	r := strings.NewReader("\n" +
+		`{"status":201,"env":{"Content-Type":"text/plain"},"data":"hello","extra":true}` + "\n" +
+		`{"data_base64":"/wA="}` + "\r\n" +
+		`{}` + "\n")
+
+	result := &Result{}
+	err := JSONLinesCodec.ReadResult(r, result)
+
+	if err != nil {
+		t.Fatalf("ReadResult() returned err: %+v", err)
+	}
+
+	if result.Status != 201 || string(result.Data) != "hello" || result.Env["Content-Type"] != "text/plain" {
+		t.Errorf("Did not read expected result: %+v", result)
+	}
+
+	err = JSONLinesCodec.ReadResult(r, result)
+
+	if err != nil {
+		t.Fatalf("ReadResult() returned err: %+v", err)
+	}
+
+	if !bytes.Equal(result.Data, []byte{0xff, 0x00}) || result.Status != 0 {
+		t.Errorf("Did not read expected result: %+v", result)
+	}
+
+	err = JSONLinesCodec.ReadResult(r, result)
+
+	if err != nil {
+		t.Fatalf("ReadResult() returned err: %+v", err)
+	}
+
+	if len(result.Data) != 0 || result.Env == nil {
+		t.Errorf("Expected an empty result with an empty env, but got: %+v", result)
+	}
+
+	err = JSONLinesCodec.ReadResult(r, result)
+
+	if err != io.EOF {
+		t.Errorf("Expected EOF, but got: %+v", err)
+	}
+}
+
+func TestJSONLinesCodec_ReadResult_errors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"unterminated line", `{"data":"hello"}`},
+		{"invalid json", "not json\n"},
+		{"invalid base64", `{"data_base64":"!"}` + "\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := JSONLinesCodec.ReadResult(strings.NewReader(tt.input), &Result{})
+
+			if err == nil {
+				t.Errorf("ReadResult() did not return error")
+			}
+		})
+	}
+}
+
+func TestJSONLinesCodec_ReadResult_doesNotOverread(t *testing.T) {
+	r := io.MultiReader(strings.NewReader(`{"data":"one"}`+"\n"), strings.NewReader(`{"data":"two"}`+"\n"))
+
+	for _, want := range []string{"one", "two"} {
+		result := &Result{}
+		err := JSONLinesCodec.ReadResult(r, result)
+
+		if err != nil {
+			t.Fatalf("ReadResult() returned err: %+v", err)
+		}
+
+		if got := string(result.Data); got != want {
+			t.Errorf("Did not read expected result: got %s; want %s", got, want)
+		}
+	}
+}
+
+func TestJSONLinesCodec_roundTrip(t *testing.T) {
+	buf := &bytes.Buffer{}
+	_, err := JSONLinesCodec.WriteEvent(buf, &Input{Data: []byte("hello")})
+	if err != nil {
+		t.Fatalf("WriteEvent() returned err: %+v", err)
+	}
+
+	// A result line has the same shape as an event line.
+	var line map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatalf("Event is not valid JSON: %+v", err)
+	}
+
+	result := &Result{}
+	err = JSONLinesCodec.ReadResult(buf, result)
+
+	if err != nil {
+		t.Fatalf("ReadResult() returned err: %+v", err)
+	}
+
+	if got := string(result.Data); got != "hello" {
+		t.Errorf("Did not read expected result: got %s; want hello", got)
+	}
+}
@@ -0,0 +1,318 @@
+// Package conformance checks that a function program speaks the fnrun protocol
+// correctly, which is useful when writing a runtime for a new language.
+//
+// The function under test must echo each invocation before the stop time of
+// its execution context: it returns the input data as the result data and the
+// environment variables of the execution context as the result env. The cases
+// exchange messages with ProtobufCodec.
+package conformance
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/tessellator/executil"
+	"github.com/tessellator/fnrun"
+	"github.com/tessellator/fnrun/fnrun/protobufs"
+)
+
+// Config contains the settings used to run the function under test.
+type Config struct {
+	// Transport is the transport used to communicate with the function.
+	Transport fnrun.Transport
+
+	// Timeout is the time allowed for each invocation. If zero, ten seconds is
+	// used.
+	Timeout time.Duration
+}
+
+// Case is a single conformance check. Each case runs against a new process.
+type Case struct {
+	Name string
+
+	// codec is used to communicate with the process; if nil, ProtobufCodec is
+	// used.
+	codec fnrun.Codec
+
+	run func(invoker fnrun.Invoker, timeout time.Duration) error
+
+	// checkExit indicates that the process must exit successfully when it is
+	// closed.
+	checkExit bool
+}
+
+// CaseResult is the outcome of a Case.
+type CaseResult struct {
+	Name     string
+	Err      error
+	Duration time.Duration
+}
+
+// Passed reports whether the case passed.
+func (r CaseResult) Passed() bool {
+	return r.Err == nil
+}
+
+// Report contains the outcome of each Case that was run.
+type Report struct {
+	Results []CaseResult
+}
+
+// Passed reports whether every case passed.
+func (r *Report) Passed() bool {
+	for _, result := range r.Results {
+		if !result.Passed() {
+			return false
+		}
+	}
+	return true
+}
+
+// WriteTo writes a line for each case to w, followed by a summary.
+func (r *Report) WriteTo(w io.Writer) (int64, error) {
+	buf := &bytes.Buffer{}
+	failed := 0
+	for _, result := range r.Results {
+		if result.Passed() {
+			fmt.Fprintf(buf, "PASS  %s (%v)\n", result.Name, result.Duration.Round(time.Millisecond))
+		} else {
+			failed++
+			fmt.Fprintf(buf, "FAIL  %s: %v\n", result.Name, result.Err)
+		}
+	}
+	fmt.Fprintf(buf, "%d passed, %d failed\n", len(r.Results)-failed, failed)
+
+	return buf.WriteTo(w)
+}
+
+// Cases returns the standard conformance cases.
+func Cases() []Case {
+	return []Case{
+		{Name: "empty data", run: echoCase(nil, nil)},
+		{Name: "binary data", run: echoCase(allBytes(), nil)},
+		{Name: "large data", run: echoCase(bytes.Repeat([]byte("fnrun"), 1<<20), nil)},
+		{Name: "many env vars", run: echoCase([]byte("env"), manyEnvVars(1000))},
+		{Name: "near deadline", codec: stopTimeCodec{}, run: nearDeadlineCase},
+		{Name: "repeated invocations", run: repeatedCase},
+		{Name: "unknown fields", codec: unknownFieldsCodec{}, run: echoCase([]byte("unknown"), map[string]string{"KEY": "value"})},
+		{Name: "exit on EOF", run: echoCase([]byte("bye"), nil), checkExit: true},
+	}
+}
+
+// Run runs the standard cases against copies of cmd.
+func Run(cmd *exec.Cmd, config Config) *Report {
+	return RunCases(cmd, config, Cases())
+}
+
+// RunCases runs cases, such as a subset of those returned by Cases, against
+// copies of cmd.
+func RunCases(cmd *exec.Cmd, config Config, cases []Case) *Report {
+	timeout := config.Timeout
+	if timeout == 0 {
+		timeout = 10 * time.Second
+	}
+
+	report := &Report{}
+	for _, c := range cases {
+		start := time.Now()
+		err := runCase(cmd, config.Transport, timeout, c)
+		report.Results = append(report.Results, CaseResult{
+			Name:     c.Name,
+			Err:      err,
+			Duration: time.Since(start),
+		})
+	}
+
+	return report
+}
+
+func runCase(cmd *exec.Cmd, transport fnrun.Transport, timeout time.Duration, c Case) error {
+	newCmd := executil.CloneCmd(cmd)
+	newCmd.Stdout = cmd.Stdout
+	newCmd.Stderr = cmd.Stderr
+
+	codec := c.codec
+	if codec == nil {
+		codec = fnrun.ProtobufCodec
+	}
+
+	invoker, err := fnrun.NewCmdInvokerWithConfig(newCmd, fnrun.CmdInvokerConfig{Transport: transport, Codec: codec})
+	if err != nil {
+		return err
+	}
+
+	err = c.run(invoker, timeout)
+	invoker.(io.Closer).Close()
+	if err != nil {
+		return err
+	}
+
+	if c.checkExit && !newCmd.ProcessState.Success() {
+		return fmt.Errorf("process did not exit cleanly after EOF: %v", newCmd.ProcessState)
+	}
+
+	return nil
+}
+
+func echoCase(data []byte, env map[string]string) func(fnrun.Invoker, time.Duration) error {
+	return func(invoker fnrun.Invoker, timeout time.Duration) error {
+		return invokeEcho(invoker, timeout, data, env)
+	}
+}
+
+// nearDeadlineCase tells the function that its stop time is a tenth of the
+// timeout away, while still allowing the invocation the whole timeout, and
+// checks that the function responds before the stop time.
+func nearDeadlineCase(invoker fnrun.Invoker, timeout time.Duration) error {
+	stopTime := time.Now().Add(timeout / 10)
+	ctx := context.WithValue(context.Background(), stopTimeKey{}, stopTime)
+
+	err := invokeEchoContext(ctx, invoker, timeout, []byte("hurry"), nil)
+	if err != nil {
+		return err
+	}
+
+	if late := time.Since(stopTime); late > 0 {
+		return fmt.Errorf("function responded %v after its stop time", late.Round(time.Millisecond))
+	}
+	return nil
+}
+
+func repeatedCase(invoker fnrun.Invoker, timeout time.Duration) error {
+	for i := 0; i < 100; i++ {
+		n := strconv.Itoa(i)
+		err := invokeEcho(invoker, timeout, []byte(n), map[string]string{"N": n})
+		if err != nil {
+			return fmt.Errorf("invocation %d: %v", i, err)
+		}
+	}
+	return nil
+}
+
+// invokeEcho invokes the function and checks that it echoed data and env.
+func invokeEcho(invoker fnrun.Invoker, timeout time.Duration, data []byte, env map[string]string) error {
+	return invokeEchoContext(context.Background(), invoker, timeout, data, env)
+}
+
+// invokeEchoContext is invokeEcho with the values of ctx.
+func invokeEchoContext(ctx context.Context, invoker fnrun.Invoker, timeout time.Duration, data []byte, env map[string]string) error {
+	ctx = fnrun.WithEnv(ctx, env)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	result, err := invoker.Invoke(ctx, &fnrun.Input{Data: data})
+	if err != nil {
+		return err
+	}
+
+	if !bytes.Equal(result.Data, data) {
+		return fmt.Errorf("expected %d bytes of echoed data, but got %d different bytes", len(data), len(result.Data))
+	}
+
+	if len(result.Env) != len(env) {
+		return fmt.Errorf("expected %d echoed env vars, but got %d", len(env), len(result.Env))
+	}
+	for k, v := range env {
+		if result.Env[k] != v {
+			return fmt.Errorf("expected env var %s to be echoed as %q, but got %q", k, v, result.Env[k])
+		}
+	}
+
+	return nil
+}
+
+func allBytes() []byte {
+	b := make([]byte, 256)
+	for i := range b {
+		b[i] = byte(i)
+	}
+	return b
+}
+
+func manyEnvVars(n int) map[string]string {
+	env := make(map[string]string, n)
+	for i := 0; i < n; i++ {
+		env["VAR_"+strconv.Itoa(i)] = strconv.Itoa(i)
+	}
+	return env
+}
+
+type stopTimeKey struct{}
+
+// stopTimeCodec is ProtobufCodec that sends the stop time placed on the
+// context under stopTimeKey, if it is earlier than the deadline of the
+// context, so that the function can be told of a stop time that is nearer
+// than the one the runner enforces.
+type stopTimeCodec struct{}
+
+func (stopTimeCodec) WriteEvent(w io.Writer, input *fnrun.Input) (int64, error) {
+	return fnrun.ProtobufCodec.WriteEvent(w, input)
+}
+
+func (stopTimeCodec) WriteExecutionContext(ctx context.Context, w io.Writer) (int64, error) {
+	if stopTime, ok := ctx.Value(stopTimeKey{}).(time.Time); ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, stopTime)
+		defer cancel()
+	}
+	return fnrun.ProtobufCodec.WriteExecutionContext(ctx, w)
+}
+
+func (stopTimeCodec) ReadResult(r io.Reader, result *fnrun.Result) error {
+	return fnrun.ProtobufCodec.ReadResult(r, result)
+}
+
+// unknownField is a protobuf varint field with number 999 and value 1, which
+// is not defined by any fnrun message.
+var unknownField = []byte{0xb8, 0x3e, 0x01}
+
+// unknownFieldsCodec is ProtobufCodec with an unknown field added to the
+// messages it writes, as a newer runner might send.
+type unknownFieldsCodec struct{}
+
+func (unknownFieldsCodec) WriteEvent(w io.Writer, input *fnrun.Input) (int64, error) {
+	return writeWithUnknownField(w, &protobufs.Event{Data: input.Data})
+}
+
+func (unknownFieldsCodec) WriteExecutionContext(ctx context.Context, w io.Writer) (int64, error) {
+	buf := &bytes.Buffer{}
+	_, err := fnrun.ProtobufCodec.WriteExecutionContext(ctx, buf)
+	if err != nil {
+		return 0, err
+	}
+
+	execCtx := &protobufs.ExecutionContext{}
+	err = proto.Unmarshal(buf.Bytes()[4:], execCtx)
+	if err != nil {
+		return 0, err
+	}
+
+	return writeWithUnknownField(w, execCtx)
+}
+
+func (unknownFieldsCodec) ReadResult(r io.Reader, result *fnrun.Result) error {
+	return fnrun.ProtobufCodec.ReadResult(r, result)
+}
+
+func writeWithUnknownField(w io.Writer, msg proto.Message) (int64, error) {
+	b, err := proto.Marshal(msg)
+	if err != nil {
+		return 0, err
+	}
+	b = append(b, unknownField...)
+
+	err = binary.Write(w, binary.BigEndian, int32(len(b)))
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := w.Write(b)
+	return int64(n + 4), err
+}
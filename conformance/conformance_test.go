@@ -0,0 +1,115 @@
+package conformance
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tessellator/fnrun"
+	"github.com/tessellator/fnrun/fnruntest"
+)
+
+func TestRun(t *testing.T) {
+	for _, transport := range []fnrun.Transport{fnrun.StdioTransport, fnrun.SocketTransport} {
+		report := Run(fnruntest.SubprocessCommand("TestEchoFunction"), Config{Transport: transport})
+
+		if !report.Passed() {
+			buf := &bytes.Buffer{}
+			report.WriteTo(buf)
+			t.Errorf("Expected all cases to pass, but got:\n%s", buf)
+		}
+
+		if len(report.Results) != len(Cases()) {
+			t.Errorf("Expected %d results, but got: %d", len(Cases()), len(report.Results))
+		}
+	}
+}
+
+func TestRun_nonconforming(t *testing.T) {
+	report := Run(fnruntest.SubprocessCommand("TestDataOnlyFunction"), Config{})
+
+	failed := map[string]bool{}
+	for _, result := range report.Results {
+		failed[result.Name] = !result.Passed()
+	}
+
+	for _, name := range []string{"many env vars", "repeated invocations", "unknown fields"} {
+		if !failed[name] {
+			t.Errorf("Expected case %q to fail", name)
+		}
+	}
+
+	for _, name := range []string{"empty data", "large data"} {
+		if failed[name] {
+			t.Errorf("Expected case %q to pass", name)
+		}
+	}
+}
+
+func TestRun_nearDeadline(t *testing.T) {
+	var cases []Case
+	for _, c := range Cases() {
+		if c.Name == "near deadline" {
+			cases = append(cases, c)
+		}
+	}
+
+	config := Config{Timeout: time.Second}
+	report := RunCases(fnruntest.SubprocessCommand("TestEchoFunction"), config, cases)
+	if !report.Passed() {
+		t.Errorf("Expected a prompt function to pass, but got: %+v", report.Results)
+	}
+
+	report = RunCases(fnruntest.SubprocessCommand("TestSlowFunction"), config, cases)
+	if len(report.Results) != 1 || report.Results[0].Passed() {
+		t.Fatalf("Expected a function that ignores its stop time to fail, but got: %+v", report.Results)
+	}
+	if err := report.Results[0].Err; !strings.Contains(err.Error(), "after its stop time") {
+		t.Errorf("Expected the function to respond after its stop time, but got: %+v", err)
+	}
+}
+
+func TestReport_WriteTo(t *testing.T) {
+	report := &Report{Results: []CaseResult{
+		{Name: "good"},
+		{Name: "bad", Err: fnrun.ErrMissingTimeout},
+	}}
+
+	buf := &bytes.Buffer{}
+	report.WriteTo(buf)
+
+	for _, want := range []string{"PASS  good", "FAIL  bad: " + fnrun.ErrMissingTimeout.Error(), "1 passed, 1 failed"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("Expected report to contain %q, but got:\n%s", want, buf)
+		}
+	}
+
+	if report.Passed() {
+		t.Errorf("Expected the report not to pass")
+	}
+}
+
+// ---
+
+func TestEchoFunction(t *testing.T) {
+	fnruntest.ServeSubprocess(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		env, _ := fnrun.Env(ctx)
+		return &fnrun.Result{Data: input.Data, Env: env}, nil
+	})
+}
+
+func TestSlowFunction(t *testing.T) {
+	fnruntest.ServeSubprocess(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		env, _ := fnrun.Env(ctx)
+		time.Sleep(300 * time.Millisecond)
+		return &fnrun.Result{Data: input.Data, Env: env}, nil
+	})
+}
+
+func TestDataOnlyFunction(t *testing.T) {
+	fnruntest.ServeSubprocess(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		return &fnrun.Result{Data: input.Data}, nil
+	})
+}
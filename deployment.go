@@ -0,0 +1,265 @@
+package fnrun
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrRolledBack is an error that indicates that a rollout was rolled back
+// because the new version exceeded the error rate threshold.
+var ErrRolledBack = errors.New("rollout rolled back")
+
+// ErrRolloutInProgress is an error that indicates that a Deployment is already
+// rolling out a new version.
+var ErrRolloutInProgress = errors.New("rollout already in progress")
+
+// RolloutConfig contains the configuration data for Deployment.Rollout.
+type RolloutConfig struct {
+	// ReadinessCheck, if set, is called with the new pool before it receives
+	// any traffic. The rollout is abandoned if it returns an error. If it is
+	// not set, the new pool is considered ready once its initial invokers have
+	// been created.
+	ReadinessCheck func(context.Context, Invoker) error
+
+	// ReadinessTimeout is the maximum duration of the ReadinessCheck. A value
+	// of zero means that only the context given to Rollout limits it.
+	ReadinessTimeout time.Duration
+
+	// ObservationPeriod is how long the new version is watched after it starts
+	// receiving traffic. The previous version is kept running until the period
+	// ends so that the rollout can be rolled back.
+	ObservationPeriod time.Duration
+
+	// MaxErrorRate is the fraction of invocations of the new version, between
+	// 0 and 1, that may fail during the ObservationPeriod before the rollout
+	// is rolled back. A value of zero disables automatic rollback.
+	MaxErrorRate float64
+
+	// MinInvocations is the number of invocations of the new version that must
+	// complete before its error rate is compared to MaxErrorRate.
+	MinInvocations int
+}
+
+// deploymentTarget is a pool that a Deployment routes invocations to, along
+// with counts of the invocations it has handled.
+type deploymentTarget struct {
+	// The counters are updated atomically and come first so that they are
+	// 64-bit aligned on 32-bit platforms.
+	invocations int64
+	errors      int64
+
+	pool           *InvokerPool
+	maxErrorRate   float64
+	minInvocations int64
+	tripOnce       sync.Once
+	tripped        chan struct{}
+}
+
+func newDeploymentTarget(pool *InvokerPool) *deploymentTarget {
+	return &deploymentTarget{pool: pool, tripped: make(chan struct{})}
+}
+
+// record counts the outcome of an invocation and signals tripped once the
+// error rate exceeds the threshold of the target.
+func (target *deploymentTarget) record(err error) {
+	invocations := atomic.AddInt64(&target.invocations, 1)
+	errs := atomic.LoadInt64(&target.errors)
+	if err != nil {
+		errs = atomic.AddInt64(&target.errors, 1)
+	}
+
+	if target.maxErrorRate <= 0 || invocations < target.minInvocations {
+		return
+	}
+	if float64(errs)/float64(invocations) > target.maxErrorRate {
+		target.tripOnce.Do(func() { close(target.tripped) })
+	}
+}
+
+// Deployment is an Invoker that serves a function from one InvokerPool at a
+// time and can replace that pool with a new version without dropping
+// invocations.
+//
+// Rollout starts the new version alongside the current one, checks that it is
+// ready, and then routes all new invocations to it. Invocations already in
+// progress finish on the previous version, which is closed once the rollout
+// has been observed to succeed. If the new version fails too often during the
+// observation period, invocations are routed back to the previous version and
+// the new one is closed.
+type Deployment struct {
+	mu         sync.RWMutex
+	current    *deploymentTarget
+	rollingOut bool
+	closed     bool
+}
+
+// NewDeployment creates a Deployment that serves invocations from a new pool
+// created with config.
+func NewDeployment(config InvokerPoolConfig) (*Deployment, error) {
+	pool, err := NewInvokerPool(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Deployment{current: newDeploymentTarget(pool)}, nil
+}
+
+// Pool returns the pool that currently receives new invocations.
+func (d *Deployment) Pool() *InvokerPool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.current.pool
+}
+
+// Invoke satisfies the invocation request with the current pool.
+//
+// If the pool is closed by a rollout or rollback before the invocation gets an
+// Invoker, the invocation is retried on the pool that replaced it.
+func (d *Deployment) Invoke(ctx context.Context, input *Input) (*Result, error) {
+	d.mu.RLock()
+	target := d.current
+	d.mu.RUnlock()
+
+	for {
+		result, err := target.pool.Invoke(ctx, input)
+		if err == ErrPoolClosed {
+			d.mu.RLock()
+			next, closed := d.current, d.closed
+			d.mu.RUnlock()
+			if !closed && next != target {
+				target = next
+				continue
+			}
+		}
+
+		target.record(err)
+		return result, err
+	}
+}
+
+// Rollout replaces the current pool with a new pool created with config.
+//
+// Rollout blocks until the new version has been promoted or abandoned. It
+// returns nil once the new version has been observed for the ObservationPeriod
+// of rollout without exceeding its MaxErrorRate and the previous pool has
+// been closed. It returns ErrRolledBack if the new version was rolled back,
+// the error of the ReadinessCheck if the new version never became ready, and
+// ErrRolloutInProgress if another rollout has not finished. If ctx is done
+// before the rollout finishes, the new version is rolled back and the error
+// of ctx is returned.
+func (d *Deployment) Rollout(ctx context.Context, config InvokerPoolConfig, rollout RolloutConfig) error {
+	if rollout.MaxErrorRate < 0 || rollout.MaxErrorRate > 1 {
+		return errors.New("max error rate must be between 0 and 1")
+	}
+
+	if err := d.startRollout(); err != nil {
+		return err
+	}
+	defer d.finishRollout()
+
+	pool, err := NewInvokerPool(config)
+	if err != nil {
+		return err
+	}
+
+	if err := checkReadiness(ctx, pool, rollout); err != nil {
+		pool.Close()
+		return fmt.Errorf("new version is not ready: %w", err)
+	}
+
+	next := newDeploymentTarget(pool)
+	next.maxErrorRate = rollout.MaxErrorRate
+	next.minInvocations = int64(rollout.MinInvocations)
+
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		pool.Close()
+		return ErrPoolClosed
+	}
+	previous := d.current
+	d.current = next
+	d.mu.Unlock()
+
+	timer := time.NewTimer(rollout.ObservationPeriod)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return previous.pool.Close()
+	case <-next.tripped:
+		d.rollBack(next, previous)
+		return ErrRolledBack
+	case <-ctx.Done():
+		d.rollBack(next, previous)
+		return ctx.Err()
+	}
+}
+
+// rollBack routes invocations back to previous and closes next. If the
+// Deployment was closed during the rollout, previous is closed instead.
+func (d *Deployment) rollBack(next, previous *deploymentTarget) {
+	d.mu.Lock()
+	closed := d.closed
+	if !closed {
+		d.current = previous
+	}
+	d.mu.Unlock()
+
+	if closed {
+		previous.pool.Close()
+	}
+	next.pool.Close()
+}
+
+func checkReadiness(ctx context.Context, pool *InvokerPool, rollout RolloutConfig) error {
+	if rollout.ReadinessCheck == nil {
+		return nil
+	}
+
+	if rollout.ReadinessTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, rollout.ReadinessTimeout)
+		defer cancel()
+	}
+	return rollout.ReadinessCheck(ctx, pool)
+}
+
+func (d *Deployment) startRollout() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.closed {
+		return ErrPoolClosed
+	}
+	if d.rollingOut {
+		return ErrRolloutInProgress
+	}
+	d.rollingOut = true
+	return nil
+}
+
+func (d *Deployment) finishRollout() {
+	d.mu.Lock()
+	d.rollingOut = false
+	d.mu.Unlock()
+}
+
+// Close closes the current pool. A rollout in progress closes the pools it
+// holds when it finishes. Calls to Invoke after Close return ErrPoolClosed.
+func (d *Deployment) Close() error {
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		return nil
+	}
+	d.closed = true
+	current := d.current
+	d.mu.Unlock()
+
+	return current.pool.Close()
+}
@@ -0,0 +1,177 @@
+package fnrun
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDeployment_Rollout(t *testing.T) {
+	d, err := NewDeployment(labelPoolConfig("v1", 1))
+	if err != nil {
+		t.Fatalf("NewDeployment() returned err: %+v", err)
+	}
+	defer d.Close()
+
+	if got := invokeData(context.Background(), t, d); got != "v1" {
+		t.Fatalf("Expected v1 before the rollout, but got: %s", got)
+	}
+
+	previous := d.Pool()
+	err = d.Rollout(context.Background(), labelPoolConfig("v2", 1), RolloutConfig{
+		ObservationPeriod: 10 * time.Millisecond,
+		MaxErrorRate:      0.5,
+	})
+	if err != nil {
+		t.Fatalf("Rollout() returned err: %+v", err)
+	}
+
+	if got := invokeData(context.Background(), t, d); got != "v2" {
+		t.Errorf("Expected v2 after the rollout, but got: %s", got)
+	}
+	if _, err := previous.Invoke(context.Background(), &Input{}); err != ErrPoolClosed {
+		t.Errorf("Expected the previous pool to be closed, but got: %+v", err)
+	}
+}
+
+func TestDeployment_Rollout_rollback(t *testing.T) {
+	d, err := NewDeployment(labelPoolConfig("v1", 1))
+	if err != nil {
+		t.Fatalf("NewDeployment() returned err: %+v", err)
+	}
+	defer d.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- d.Rollout(context.Background(), failingPoolConfig(1), RolloutConfig{
+			ObservationPeriod: 10 * time.Second,
+			MaxErrorRate:      0.5,
+			MinInvocations:    2,
+		})
+	}()
+
+	timeout := time.After(5 * time.Second)
+	for rolledBack := false; !rolledBack; {
+		select {
+		case err := <-done:
+			if err != ErrRolledBack {
+				t.Fatalf("Expected ErrRolledBack, but got: %+v", err)
+			}
+			rolledBack = true
+		case <-timeout:
+			t.Fatal("Expected the rollout to be rolled back before the observation period ended")
+		default:
+			d.Invoke(context.Background(), &Input{})
+		}
+	}
+
+	if got := invokeData(context.Background(), t, d); got != "v1" {
+		t.Errorf("Expected v1 after the rollback, but got: %s", got)
+	}
+}
+
+func TestDeployment_Rollout_notReady(t *testing.T) {
+	d, err := NewDeployment(labelPoolConfig("v1", 1))
+	if err != nil {
+		t.Fatalf("NewDeployment() returned err: %+v", err)
+	}
+	defer d.Close()
+
+	err = d.Rollout(context.Background(), failingPoolConfig(1), RolloutConfig{
+		ReadinessCheck: func(ctx context.Context, invoker Invoker) error {
+			_, err := invoker.Invoke(ctx, &Input{})
+			return err
+		},
+		ReadinessTimeout: time.Second,
+	})
+	if !errors.Is(err, ErrFake) {
+		t.Errorf("Expected the readiness check error, but got: %+v", err)
+	}
+
+	if got := invokeData(context.Background(), t, d); got != "v1" {
+		t.Errorf("Expected v1 after the failed rollout, but got: %s", got)
+	}
+}
+
+func TestDeployment_Rollout_inProgress(t *testing.T) {
+	d, err := NewDeployment(labelPoolConfig("v1", 1))
+	if err != nil {
+		t.Fatalf("NewDeployment() returned err: %+v", err)
+	}
+	defer d.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- d.Rollout(ctx, labelPoolConfig("v2", 1), RolloutConfig{ObservationPeriod: 10 * time.Second})
+	}()
+
+	waitFor(t, func() bool { return invokeData(context.Background(), t, d) == "v2" })
+	if err := d.Rollout(context.Background(), labelPoolConfig("v3", 1), RolloutConfig{}); err != ErrRolloutInProgress {
+		t.Errorf("Expected ErrRolloutInProgress, but got: %+v", err)
+	}
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("Expected context.Canceled, but got: %+v", err)
+	}
+	if got := invokeData(context.Background(), t, d); got != "v1" {
+		t.Errorf("Expected v1 after the canceled rollout, but got: %s", got)
+	}
+}
+
+func TestDeployment_Rollout_noFailedInvocations(t *testing.T) {
+	d, err := NewDeployment(labelPoolConfig("v1", 2))
+	if err != nil {
+		t.Fatalf("NewDeployment() returned err: %+v", err)
+	}
+	defer d.Close()
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if _, err := d.Invoke(context.Background(), &Input{}); err != nil {
+					t.Errorf("Invoke() returned err during the rollout: %+v", err)
+					return
+				}
+			}
+		}()
+	}
+
+	for _, version := range []string{"v2", "v3"} {
+		if err := d.Rollout(context.Background(), labelPoolConfig(version, 2), RolloutConfig{ObservationPeriod: time.Millisecond}); err != nil {
+			t.Errorf("Rollout(%s) returned err: %+v", version, err)
+		}
+	}
+
+	close(stop)
+	wg.Wait()
+}
+
+func TestDeployment_Close(t *testing.T) {
+	d, err := NewDeployment(labelPoolConfig("v1", 1))
+	if err != nil {
+		t.Fatalf("NewDeployment() returned err: %+v", err)
+	}
+
+	if err := d.Close(); err != nil {
+		t.Fatalf("Close() returned err: %+v", err)
+	}
+	if _, err := d.Invoke(context.Background(), &Input{}); err != ErrPoolClosed {
+		t.Errorf("Expected ErrPoolClosed, but got: %+v", err)
+	}
+	if err := d.Rollout(context.Background(), labelPoolConfig("v2", 1), RolloutConfig{}); err != ErrPoolClosed {
+		t.Errorf("Expected ErrPoolClosed, but got: %+v", err)
+	}
+}
@@ -0,0 +1,85 @@
+package fnrungrpc
+
+import (
+	"context"
+
+	"github.com/golang/protobuf/proto"
+	tspb "github.com/golang/protobuf/ptypes"
+	"github.com/tessellator/fnrun"
+	"github.com/tessellator/fnrun/fnrun/protobufs"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+type client struct {
+	conn *grpc.ClientConn
+}
+
+// NewClient creates an Invoker that performs invocations through the gRPC
+// service registered by RegisterInvokerServer.
+//
+// The environment variables and deadline of the context passed to Invoke are
+// sent to the server. A DeadlineExceeded status is returned as
+// context.DeadlineExceeded; other failures are returned as gRPC status errors.
+func NewClient(conn *grpc.ClientConn) fnrun.Invoker {
+	return &client{conn: conn}
+}
+
+func (c *client) Invoke(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+	ctx, err := WithOutgoingExecutionContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &protobufs.Result{}
+	err = c.conn.Invoke(ctx, "/"+serviceName+"/Invoke", &protobufs.Event{Data: input.Data}, result)
+	if err != nil {
+		if status.Code(err) == codes.DeadlineExceeded {
+			return nil, context.DeadlineExceeded
+		}
+		return nil, err
+	}
+
+	return resultFromProto(result), nil
+}
+
+// WithOutgoingExecutionContext adds the environment variables and deadline of
+// ctx to its outgoing gRPC metadata as an ExecutionContext message.
+func WithOutgoingExecutionContext(ctx context.Context) (context.Context, error) {
+	execCtx := &protobufs.ExecutionContext{}
+
+	env, _ := fnrun.Env(ctx)
+	for k, v := range env {
+		execCtx.EnvVars = append(execCtx.EnvVars, &protobufs.EnvironmentVariable{Name: k, Value: v})
+	}
+
+	if deadline, hasTimeout := ctx.Deadline(); hasTimeout {
+		stopTime, err := tspb.TimestampProto(deadline)
+		if err != nil {
+			return nil, err
+		}
+		execCtx.StopTime = stopTime
+	}
+
+	b, err := proto.Marshal(execCtx)
+	if err != nil {
+		return nil, err
+	}
+
+	return metadata.AppendToOutgoingContext(ctx, ExecutionContextMetadataKey, string(b)), nil
+}
+
+func resultFromProto(pResult *protobufs.Result) *fnrun.Result {
+	env := make(map[string]string)
+	for _, envVar := range pResult.GetEnvVars() {
+		env[envVar.GetName()] = envVar.GetValue()
+	}
+
+	return &fnrun.Result{
+		Status: int(pResult.GetStatus()),
+		Data:   pResult.GetData(),
+		Env:    env,
+	}
+}
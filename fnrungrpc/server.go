@@ -0,0 +1,210 @@
+// Package fnrungrpc exposes fnrun invokers as a gRPC service.
+//
+// The service reuses the messages from the fnrun protocol and is equivalent to
+// the following protobuf definition:
+//
+//   service Invoker {
+//     rpc Invoke(Event) returns (Result);
+//     rpc InvokeStream(stream Event) returns (stream Result);
+//   }
+//
+// in the fnrun.protobuf package. The ExecutionContext for an invocation is
+// carried in the binary metadata entry named by ExecutionContextMetadataKey;
+// its environment variables are made available to the function, and its stop
+// time is applied as a deadline in addition to any gRPC deadline.
+package fnrungrpc
+
+import (
+	"context"
+	"io"
+
+	"github.com/golang/protobuf/proto"
+	tspb "github.com/golang/protobuf/ptypes"
+	"github.com/tessellator/fnrun"
+	"github.com/tessellator/fnrun/fnrun/protobufs"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// ExecutionContextMetadataKey is the gRPC metadata key that carries a
+// serialized ExecutionContext message.
+const ExecutionContextMetadataKey = "fnrun-execution-context-bin"
+
+const serviceName = "fnrun.protobuf.Invoker"
+
+// RegisterInvokerServer registers a gRPC service on s that satisfies
+// invocations with invoker, which is typically an fnrun.InvokerPool.
+//
+// The context passed to invoker carries the deadline of the gRPC call, so an
+// invoker that requires a timeout, such as one created by fnrun.NewCmdInvoker,
+// can be used directly as long as clients set a deadline.
+func RegisterInvokerServer(s *grpc.Server, invoker fnrun.Invoker) {
+	s.RegisterService(&serviceDesc, &server{invoker: invoker})
+}
+
+// invokerServer is the interface the service handlers are registered against.
+type invokerServer interface {
+	invoke(context.Context, *protobufs.Event) (*protobufs.Result, error)
+	invokeStream(grpc.ServerStream) error
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: serviceName,
+	HandlerType: (*invokerServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Invoke",
+			Handler:    invokeHandler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "InvokeStream",
+			Handler:       invokeStreamHandler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "fnrun.proto",
+}
+
+func invokeHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	event := &protobufs.Event{}
+	if err := dec(event); err != nil {
+		return nil, err
+	}
+
+	s := srv.(invokerServer)
+	if interceptor == nil {
+		return s.invoke(ctx, event)
+	}
+
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/" + serviceName + "/Invoke",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return s.invoke(ctx, req.(*protobufs.Event))
+	}
+	return interceptor(ctx, event, info, handler)
+}
+
+func invokeStreamHandler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(invokerServer).invokeStream(stream)
+}
+
+type server struct {
+	invoker fnrun.Invoker
+}
+
+func (s *server) invoke(ctx context.Context, event *protobufs.Event) (*protobufs.Result, error) {
+	ctx, cancel, err := withExecutionContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+
+	return s.invokeEvent(ctx, event)
+}
+
+func (s *server) invokeStream(stream grpc.ServerStream) error {
+	ctx, cancel, err := withExecutionContext(stream.Context())
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	for {
+		event := &protobufs.Event{}
+		if err := stream.RecvMsg(event); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+
+		result, err := s.invokeEvent(ctx, event)
+		if err != nil {
+			return err
+		}
+
+		if err := stream.SendMsg(result); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *server) invokeEvent(ctx context.Context, event *protobufs.Event) (*protobufs.Result, error) {
+	result, err := s.invoker.Invoke(ctx, &fnrun.Input{Data: event.GetData()})
+	if err != nil {
+		return nil, statusForError(err)
+	}
+
+	return resultToProto(result), nil
+}
+
+// withExecutionContext applies the ExecutionContext from the incoming metadata
+// of ctx, if any, to ctx.
+func withExecutionContext(ctx context.Context) (context.Context, context.CancelFunc, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get(ExecutionContextMetadataKey)
+	if len(values) == 0 {
+		ctx, cancel := context.WithCancel(ctx)
+		return ctx, cancel, nil
+	}
+
+	execCtx := &protobufs.ExecutionContext{}
+	err := proto.Unmarshal([]byte(values[0]), execCtx)
+	if err != nil {
+		return nil, nil, status.Errorf(codes.InvalidArgument, "invalid execution context: %v", err)
+	}
+
+	env := make(map[string]string)
+	for _, envVar := range execCtx.GetEnvVars() {
+		env[envVar.GetName()] = envVar.GetValue()
+	}
+	ctx = fnrun.WithEnv(ctx, env)
+
+	if execCtx.GetStopTime() == nil {
+		ctx, cancel := context.WithCancel(ctx)
+		return ctx, cancel, nil
+	}
+
+	stopTime, err := tspb.Timestamp(execCtx.GetStopTime())
+	if err != nil {
+		return nil, nil, status.Errorf(codes.InvalidArgument, "invalid stop time: %v", err)
+	}
+
+	ctx, cancel := context.WithDeadline(ctx, stopTime)
+	return ctx, cancel, nil
+}
+
+func statusForError(err error) error {
+	switch err {
+	case fnrun.ErrAvailabilityTimeout, fnrun.ErrPoolClosed:
+		return status.Error(codes.Unavailable, err.Error())
+	case fnrun.ErrMissingTimeout:
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case context.DeadlineExceeded:
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	case context.Canceled:
+		return status.Error(codes.Canceled, err.Error())
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
+
+func resultToProto(result *fnrun.Result) *protobufs.Result {
+	envVars := []*protobufs.EnvironmentVariable{}
+	for k, v := range result.Env {
+		envVars = append(envVars, &protobufs.EnvironmentVariable{Name: k, Value: v})
+	}
+
+	return &protobufs.Result{
+		EnvVars: envVars,
+		Data:    result.Data,
+		Status:  int32(result.Status),
+	}
+}
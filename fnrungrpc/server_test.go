@@ -0,0 +1,176 @@
+package fnrungrpc
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/tessellator/fnrun"
+	"github.com/tessellator/fnrun/fnrun/protobufs"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestInvoke(t *testing.T) {
+	conn, stop := startServer(t, &greetingInvoker{})
+	defer stop()
+
+	ctx := fnrun.WithEnv(context.Background(), map[string]string{"GREETING": "Hello"})
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	result, err := NewClient(conn).Invoke(ctx, &fnrun.Input{Data: []byte("world")})
+
+	if err != nil {
+		t.Fatalf("Invoke() returned err: %+v", err)
+	}
+
+	want := "Hello, world!"
+	if got := string(result.Data); got != want {
+		t.Errorf("Did not read expected result: got %s; want %s", got, want)
+	}
+
+	if result.Env["HAS_DEADLINE"] != "true" {
+		t.Errorf("Expected the deadline to be propagated to the invoker")
+	}
+}
+
+func TestInvoke_errors(t *testing.T) {
+	tests := []struct {
+		err  error
+		want codes.Code
+	}{
+		{fnrun.ErrAvailabilityTimeout, codes.Unavailable},
+		{fnrun.ErrMissingTimeout, codes.FailedPrecondition},
+		{errors.New("boom"), codes.Internal},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.err.Error(), func(t *testing.T) {
+			conn, stop := startServer(t, &errInvoker{err: tt.err})
+			defer stop()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+
+			_, err := NewClient(conn).Invoke(ctx, &fnrun.Input{})
+
+			if code := status.Code(err); code != tt.want {
+				t.Errorf("Expected code %v, but got %v", tt.want, code)
+			}
+		})
+	}
+}
+
+func TestInvoke_deadlineExceeded(t *testing.T) {
+	conn, stop := startServer(t, &errInvoker{err: context.DeadlineExceeded})
+	defer stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	_, err := NewClient(conn).Invoke(ctx, &fnrun.Input{})
+
+	if err != context.DeadlineExceeded {
+		t.Errorf("Expected deadline exceeded error but got: %+v", err)
+	}
+}
+
+func TestInvokeStream(t *testing.T) {
+	conn, stop := startServer(t, &greetingInvoker{})
+	defer stop()
+
+	ctx := fnrun.WithEnv(context.Background(), map[string]string{"GREETING": "Hi"})
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	ctx, err := WithOutgoingExecutionContext(ctx)
+	if err != nil {
+		t.Fatalf("WithOutgoingExecutionContext() returned err: %+v", err)
+	}
+
+	desc := &grpc.StreamDesc{StreamName: "InvokeStream", ServerStreams: true, ClientStreams: true}
+	stream, err := conn.NewStream(ctx, desc, "/fnrun.protobuf.Invoker/InvokeStream")
+	if err != nil {
+		t.Fatalf("NewStream() returned err: %+v", err)
+	}
+
+	for _, name := range []string{"world", "again"} {
+		err = stream.SendMsg(&protobufs.Event{Data: []byte(name)})
+		if err != nil {
+			t.Fatalf("SendMsg() returned err: %+v", err)
+		}
+
+		result := &protobufs.Result{}
+		err = stream.RecvMsg(result)
+		if err != nil {
+			t.Fatalf("RecvMsg() returned err: %+v", err)
+		}
+
+		want := "Hi, " + name + "!"
+		if got := string(result.GetData()); got != want {
+			t.Errorf("Did not read expected result: got %s; want %s", got, want)
+		}
+	}
+
+	stream.CloseSend()
+}
+
+// startServer serves invoker over gRPC and returns a connection to it along
+// with a function that stops the server and closes the connection.
+func startServer(t *testing.T, invoker fnrun.Invoker) (*grpc.ClientConn, func()) {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() returned err: %+v", err)
+	}
+
+	s := grpc.NewServer()
+	RegisterInvokerServer(s, invoker)
+	go s.Serve(listener)
+
+	conn, err := grpc.Dial(listener.Addr().String(), grpc.WithInsecure())
+	if err != nil {
+		s.Stop()
+		t.Fatalf("Dial() returned err: %+v", err)
+	}
+
+	stop := func() {
+		conn.Close()
+		s.Stop()
+	}
+
+	return conn, stop
+}
+
+// -----------------------------------------------------------------------------
+// Sample invokers
+
+type greetingInvoker struct{}
+
+func (gi *greetingInvoker) Invoke(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+	env, _ := fnrun.Env(ctx)
+	_, hasDeadline := ctx.Deadline()
+
+	result := &fnrun.Result{
+		Data: []byte(env["GREETING"] + ", " + string(input.Data) + "!"),
+		Env:  map[string]string{},
+	}
+	if hasDeadline {
+		result.Env["HAS_DEADLINE"] = "true"
+	}
+
+	return result, nil
+}
+
+type errInvoker struct {
+	err error
+}
+
+func (ei *errInvoker) Invoke(context.Context, *fnrun.Input) (*fnrun.Result, error) {
+	return nil, ei.err
+}
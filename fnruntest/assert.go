@@ -0,0 +1,47 @@
+package fnruntest
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/tessellator/fnrun"
+)
+
+// AssertResult reports a test error if got does not have the same status, data
+// and env as want. A nil env is treated as empty.
+func AssertResult(t testing.TB, got, want *fnrun.Result) {
+	t.Helper()
+
+	if got == nil || want == nil {
+		if got != want {
+			t.Errorf("Expected result %+v, but got: %+v", want, got)
+		}
+		return
+	}
+
+	if got.Status != want.Status {
+		t.Errorf("Expected result status %d, but got: %d", want.Status, got.Status)
+	}
+
+	if !bytes.Equal(got.Data, want.Data) {
+		t.Errorf("Expected result data %q, but got: %q", want.Data, got.Data)
+	}
+
+	if !envEqual(got.Env, want.Env) {
+		t.Errorf("Expected result env %v, but got: %v", want.Env, got.Env)
+	}
+}
+
+func envEqual(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for k, v := range a {
+		if bv, ok := b[k]; !ok || bv != v {
+			return false
+		}
+	}
+
+	return true
+}
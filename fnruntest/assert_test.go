@@ -0,0 +1,57 @@
+package fnruntest
+
+import (
+	"testing"
+
+	"github.com/tessellator/fnrun"
+)
+
+// recordingTB records the errors reported through it.
+type recordingTB struct {
+	testing.TB
+	errors int
+}
+
+func (tb *recordingTB) Helper() {}
+
+func (tb *recordingTB) Errorf(format string, args ...interface{}) {
+	tb.errors++
+}
+
+func TestAssertResult(t *testing.T) {
+	want := &fnrun.Result{Status: 200, Data: []byte("data"), Env: map[string]string{"KEY": "value"}}
+
+	tests := []struct {
+		name   string
+		got    *fnrun.Result
+		errors int
+	}{
+		{"equal", &fnrun.Result{Status: 200, Data: []byte("data"), Env: map[string]string{"KEY": "value"}}, 0},
+		{"different status", &fnrun.Result{Status: 500, Data: []byte("data"), Env: map[string]string{"KEY": "value"}}, 1},
+		{"different data", &fnrun.Result{Status: 200, Data: []byte("other"), Env: map[string]string{"KEY": "value"}}, 1},
+		{"different env", &fnrun.Result{Status: 200, Data: []byte("data"), Env: map[string]string{"KEY": "other"}}, 1},
+		{"nil", nil, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tb := &recordingTB{TB: t}
+
+			AssertResult(tb, tt.got, want)
+
+			if tb.errors != tt.errors {
+				t.Errorf("Expected %d errors, but got: %d", tt.errors, tb.errors)
+			}
+		})
+	}
+}
+
+func TestAssertResult_nilEnv(t *testing.T) {
+	tb := &recordingTB{TB: t}
+
+	AssertResult(tb, &fnrun.Result{Env: map[string]string{}}, &fnrun.Result{})
+
+	if tb.errors != 0 {
+		t.Errorf("Expected a nil env to equal an empty env")
+	}
+}
@@ -0,0 +1,181 @@
+// Package fnruntest provides utilities for testing code that runs functions
+// with fnrun, and for testing functions themselves.
+package fnruntest
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/tessellator/fnrun"
+)
+
+// ErrScriptExhausted is an error that indicates that a scripted Invoker or
+// Factory was called more times than it has steps.
+var ErrScriptExhausted = errors.New("fnruntest: script exhausted")
+
+// Call describes an invocation observed by an Invoker or a Recorder.
+type Call struct {
+	Input *fnrun.Input
+
+	// Env holds the environment variables on the context of the invocation.
+	Env map[string]string
+
+	// Deadline is the deadline of the context, if HasDeadline is true.
+	Deadline    time.Time
+	HasDeadline bool
+}
+
+func newCall(ctx context.Context, input *fnrun.Input) Call {
+	env, _ := fnrun.Env(ctx)
+	deadline, hasDeadline := ctx.Deadline()
+	return Call{Input: input, Env: env, Deadline: deadline, HasDeadline: hasDeadline}
+}
+
+// Step is the behavior of an Invoker for a single invocation.
+type Step struct {
+	// Result and Err are returned from Invoke.
+	Result *fnrun.Result
+	Err    error
+
+	// Delay is how long Invoke waits before returning. If the context is done
+	// first, Invoke returns the context error instead.
+	Delay time.Duration
+}
+
+// Invoker is a fake fnrun.Invoker that follows a script of steps, one per
+// invocation, and records the invocations it receives. Once the script is
+// exhausted, Invoke returns ErrScriptExhausted.
+//
+// Invoker implements io.Closer so that tests can check whether it has been
+// closed, for example by an InvokerPool.
+type Invoker struct {
+	mu     sync.Mutex
+	steps  []Step
+	calls  []Call
+	closed bool
+}
+
+// NewInvoker creates an Invoker that follows steps.
+func NewInvoker(steps ...Step) *Invoker {
+	return &Invoker{steps: steps}
+}
+
+// Invoke performs the next step of the script.
+func (inv *Invoker) Invoke(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+	inv.mu.Lock()
+	step := Step{Err: ErrScriptExhausted}
+	if len(inv.calls) < len(inv.steps) {
+		step = inv.steps[len(inv.calls)]
+	}
+	inv.calls = append(inv.calls, newCall(ctx, input))
+	inv.mu.Unlock()
+
+	if step.Delay > 0 {
+		timer := time.NewTimer(step.Delay)
+		defer timer.Stop()
+
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	return step.Result, step.Err
+}
+
+// Calls returns the invocations received so far.
+func (inv *Invoker) Calls() []Call {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	return append([]Call(nil), inv.calls...)
+}
+
+// Close marks the Invoker as closed.
+func (inv *Invoker) Close() error {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	inv.closed = true
+	return nil
+}
+
+// Closed reports whether Close has been called.
+func (inv *Invoker) Closed() bool {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	return inv.closed
+}
+
+// FactoryStep is the behavior of a Factory for a single call to NewInvoker.
+type FactoryStep struct {
+	Invoker fnrun.Invoker
+	Err     error
+}
+
+// Factory is a fake fnrun.InvokerFactory that follows a script of steps, one
+// per call to NewInvoker. Once the script is exhausted, NewInvoker returns
+// ErrScriptExhausted.
+type Factory struct {
+	mu      sync.Mutex
+	steps   []FactoryStep
+	created int
+}
+
+// NewFactory creates a Factory that follows steps.
+func NewFactory(steps ...FactoryStep) *Factory {
+	return &Factory{steps: steps}
+}
+
+// NewInvoker performs the next step of the script.
+func (f *Factory) NewInvoker() (fnrun.Invoker, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.created >= len(f.steps) {
+		f.created++
+		return nil, ErrScriptExhausted
+	}
+
+	step := f.steps[f.created]
+	f.created++
+	return step.Invoker, step.Err
+}
+
+// Calls returns the number of times NewInvoker has been called.
+func (f *Factory) Calls() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.created
+}
+
+// Recorder is an fnrun.Invoker that records the invocations it receives before
+// passing them to another Invoker.
+type Recorder struct {
+	invoker fnrun.Invoker
+
+	mu    sync.Mutex
+	calls []Call
+}
+
+// NewRecorder creates a Recorder that passes invocations to invoker.
+func NewRecorder(invoker fnrun.Invoker) *Recorder {
+	return &Recorder{invoker: invoker}
+}
+
+// Invoke records the invocation and passes it to the underlying Invoker.
+func (r *Recorder) Invoke(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+	r.mu.Lock()
+	r.calls = append(r.calls, newCall(ctx, input))
+	r.mu.Unlock()
+
+	return r.invoker.Invoke(ctx, input)
+}
+
+// Calls returns the invocations received so far.
+func (r *Recorder) Calls() []Call {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Call(nil), r.calls...)
+}
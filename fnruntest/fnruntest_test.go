@@ -0,0 +1,127 @@
+package fnruntest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/tessellator/fnrun"
+)
+
+var errFake = errors.New("fake error")
+
+func TestInvoker(t *testing.T) {
+	invoker := NewInvoker(
+		Step{Result: &fnrun.Result{Data: []byte("one")}},
+		Step{Err: errFake},
+	)
+
+	ctx := fnrun.WithEnv(context.Background(), map[string]string{"KEY": "value"})
+	ctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+
+	result, err := invoker.Invoke(ctx, &fnrun.Input{Data: []byte("first")})
+	if err != nil {
+		t.Fatalf("Invoke() returned err: %+v", err)
+	}
+	AssertResult(t, result, &fnrun.Result{Data: []byte("one")})
+
+	_, err = invoker.Invoke(ctx, &fnrun.Input{})
+	if err != errFake {
+		t.Errorf("Expected fake error, but got: %+v", err)
+	}
+
+	_, err = invoker.Invoke(ctx, &fnrun.Input{})
+	if err != ErrScriptExhausted {
+		t.Errorf("Expected script exhausted error, but got: %+v", err)
+	}
+
+	calls := invoker.Calls()
+	if len(calls) != 3 {
+		t.Fatalf("Expected 3 calls, but got: %d", len(calls))
+	}
+
+	if string(calls[0].Input.Data) != "first" || calls[0].Env["KEY"] != "value" || !calls[0].HasDeadline {
+		t.Errorf("Did not record expected call: %+v", calls[0])
+	}
+}
+
+func TestInvoker_delay(t *testing.T) {
+	invoker := NewInvoker(Step{Result: &fnrun.Result{}, Delay: time.Minute})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err := invoker.Invoke(ctx, &fnrun.Input{})
+
+	if err != context.DeadlineExceeded {
+		t.Errorf("Expected deadline exceeded error, but got: %+v", err)
+	}
+}
+
+func TestFactory_withInvokerPool(t *testing.T) {
+	failing := NewInvoker(Step{Err: errFake})
+	healthy := NewInvoker(Step{Result: &fnrun.Result{Data: []byte("ok")}})
+	factory := NewFactory(
+		FactoryStep{Invoker: failing},
+		FactoryStep{Err: errFake},
+		FactoryStep{Invoker: healthy},
+	)
+
+	pool, err := fnrun.NewInvokerPool(fnrun.InvokerPoolConfig{
+		MaxInvokerCount: 1,
+		InvokerFactory:  factory,
+		MaxWaitDuration: 5 * time.Second,
+		MaxRunnableTime: time.Second,
+	})
+	if err != nil {
+		t.Fatalf("Creating invoker pool returned err: %+v", err)
+	}
+	defer pool.Close()
+
+	_, err = pool.Invoke(context.Background(), &fnrun.Input{})
+	if err != errFake {
+		t.Errorf("Expected fake error, but got: %+v", err)
+	}
+
+	result, err := pool.Invoke(context.Background(), &fnrun.Input{})
+	if err != nil {
+		t.Fatalf("Invoke() returned err: %+v", err)
+	}
+	AssertResult(t, result, &fnrun.Result{Data: []byte("ok")})
+
+	// The pool closes failed invokers in the background.
+	deadline := time.Now().Add(5 * time.Second)
+	for !failing.Closed() && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if !failing.Closed() {
+		t.Errorf("Expected the failed invoker to be closed")
+	}
+
+	if calls := factory.Calls(); calls != 3 {
+		t.Errorf("Expected 3 calls to the factory, but got: %d", calls)
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	recorder := NewRecorder(fnrun.FuncInvoker(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		return &fnrun.Result{Data: input.Data}, nil
+	}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	deadline, _ := ctx.Deadline()
+
+	result, err := recorder.Invoke(ctx, &fnrun.Input{Data: []byte("echo")})
+	if err != nil {
+		t.Fatalf("Invoke() returned err: %+v", err)
+	}
+	AssertResult(t, result, &fnrun.Result{Data: []byte("echo")})
+
+	calls := recorder.Calls()
+	if len(calls) != 1 || !calls[0].Deadline.Equal(deadline) {
+		t.Errorf("Did not record expected calls: %+v", calls)
+	}
+}
@@ -0,0 +1,75 @@
+package fnruntest
+
+import (
+	"os"
+	"os/exec"
+	"testing"
+
+	"github.com/tessellator/fnrun"
+	"github.com/tessellator/fnrun/runtime"
+)
+
+// SubprocessEnvVar is the environment variable that marks a test binary as
+// running a function for a test in the parent process.
+const SubprocessEnvVar = "FNRUNTEST_SUBPROCESS"
+
+// ServeSubprocess serves invocations with handler and exits if the test binary
+// was started by SubprocessCommand; otherwise it returns immediately.
+//
+// It is meant to be the body of a test function that acts as a function for
+// other tests:
+//
+//	func TestEchoFunction(t *testing.T) {
+//		fnruntest.ServeSubprocess(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+//			return &fnrun.Result{Data: input.Data}, nil
+//		})
+//	}
+func ServeSubprocess(handler runtime.Handler) {
+	if os.Getenv(SubprocessEnvVar) != "1" {
+		return
+	}
+
+	runtime.Start(handler)
+	os.Exit(0)
+}
+
+// SubprocessCommand returns a command that runs only the test named testName
+// in a copy of the current test binary, marked as a subprocess so that
+// ServeSubprocess serves invocations instead of returning.
+func SubprocessCommand(testName string) *exec.Cmd {
+	cmd := exec.Command(os.Args[0], "-test.run=^"+testName+"$")
+	cmd.Env = append(os.Environ(), SubprocessEnvVar+"=1")
+	cmd.Stderr = os.Stderr
+	return cmd
+}
+
+// NewSubprocessInvoker starts the test named testName as a function with
+// SubprocessCommand and returns an Invoker for it. As with fnrun.NewCmdInvoker,
+// the Invoker implements io.Closer and should be closed when it is no longer
+// needed.
+func NewSubprocessInvoker(t testing.TB, testName string) fnrun.Invoker {
+	t.Helper()
+
+	invoker, err := fnrun.NewCmdInvoker(SubprocessCommand(testName))
+	if err != nil {
+		t.Fatalf("Starting subprocess %s returned err: %+v", testName, err)
+	}
+	return invoker
+}
+
+// NewSubprocessFactory returns a factory whose invokers run the test named
+// testName as a function with SubprocessCommand.
+func NewSubprocessFactory(testName string) fnrun.InvokerFactory {
+	return &subprocessFactory{testName: testName}
+}
+
+// subprocessFactory starts each process with SubprocessCommand, rather than
+// through fnrun.NewCmdInvokerFactory, so that it keeps the Stderr of the
+// command.
+type subprocessFactory struct {
+	testName string
+}
+
+func (factory *subprocessFactory) NewInvoker() (fnrun.Invoker, error) {
+	return fnrun.NewCmdInvoker(SubprocessCommand(factory.testName))
+}
@@ -0,0 +1,97 @@
+package fnruntest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tessellator/fnrun"
+)
+
+func TestNewSubprocessInvoker(t *testing.T) {
+	invoker := NewSubprocessInvoker(t, "TestGreetingFunction")
+	defer invoker.(io.Closer).Close()
+
+	ctx := fnrun.WithEnv(context.Background(), map[string]string{"GREETING": "Hello"})
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	result, err := invoker.Invoke(ctx, &fnrun.Input{Data: []byte("world")})
+
+	if err != nil {
+		t.Fatalf("Invoke() returned err: %+v", err)
+	}
+	AssertResult(t, result, &fnrun.Result{Data: []byte("Hello, world!")})
+}
+
+func TestNewSubprocessFactory(t *testing.T) {
+	factory := NewSubprocessFactory("TestGreetingFunction")
+
+	for i := 0; i < 2; i++ {
+		invoker, err := factory.NewInvoker()
+		if err != nil {
+			t.Fatalf("NewInvoker() returned err: %+v", err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		result, err := invoker.Invoke(ctx, &fnrun.Input{Data: []byte("again")})
+		cancel()
+
+		if err != nil {
+			t.Fatalf("Invoke() returned err: %+v", err)
+		}
+		AssertResult(t, result, &fnrun.Result{Data: []byte(", again!")})
+
+		invoker.(io.Closer).Close()
+	}
+}
+
+func TestNewSubprocessFactory_stderr(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Pipe() returned err: %+v", err)
+	}
+	defer r.Close()
+
+	stderr := os.Stderr
+	os.Stderr = w
+	invoker, err := NewSubprocessFactory("TestLoggingFunction").NewInvoker()
+	os.Stderr = stderr
+	w.Close()
+	if err != nil {
+		t.Fatalf("NewInvoker() returned err: %+v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if _, err := invoker.Invoke(ctx, &fnrun.Input{}); err != nil {
+		t.Fatalf("Invoke() returned err: %+v", err)
+	}
+	invoker.(io.Closer).Close()
+
+	output, _ := ioutil.ReadAll(r)
+	if !strings.Contains(string(output), "function log") {
+		t.Errorf("Expected the function stderr, but got: %s", output)
+	}
+}
+
+// ---
+
+func TestGreetingFunction(t *testing.T) {
+	ServeSubprocess(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		env, _ := fnrun.Env(ctx)
+		return &fnrun.Result{Data: []byte(env["GREETING"] + ", " + string(input.Data) + "!")}, nil
+	})
+}
+
+func TestLoggingFunction(t *testing.T) {
+	ServeSubprocess(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		fmt.Fprintln(os.Stderr, "function log")
+		return &fnrun.Result{}, nil
+	})
+}
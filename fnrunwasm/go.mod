@@ -0,0 +1,18 @@
+module github.com/tessellator/fnrun/fnrunwasm
+
+go 1.21
+
+require (
+	github.com/tessellator/fnrun v0.2.0
+	github.com/tessellator/protoio v0.3.0
+	github.com/tetratelabs/wazero v1.8.2
+)
+
+require (
+	github.com/golang/protobuf v1.4.3 // indirect
+	github.com/tessellator/executil v0.1.0 // indirect
+	google.golang.org/protobuf v1.25.0 // indirect
+)
+
+// The package is developed against the fnrun package in the parent directory.
+replace github.com/tessellator/fnrun => ../
@@ -0,0 +1,235 @@
+// Package fnrunwasm runs WebAssembly modules that target WASI as fnrun
+// invokers, using the wazero runtime.
+//
+// A module is written like any other fnrun function: it reads Event and
+// ExecutionContext messages from stdin and writes Result messages to stdout,
+// and it should exit when it reads EOF from stdin. Modules built with
+// GOOS=wasip1 GOARCH=wasm can use the same protocol code as native functions.
+//
+// Each Invoker runs its own instance of the module with a separate linear
+// memory, so invocations are isolated from each other and from the host. The
+// instances are given no filesystem access.
+package fnrunwasm
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"io"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/tessellator/fnrun"
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+)
+
+// closeGracePeriod is how long Close waits for a module instance to exit after
+// its stdin is closed before it is terminated.
+const closeGracePeriod = 5 * time.Second
+
+// ErrModuleExited is an error that indicates that a module instance is no
+// longer running.
+var ErrModuleExited = errors.New("wasm module is no longer running")
+
+// Config contains the settings for the invokers created by NewInvokerFactory.
+type Config struct {
+	// MemoryLimitPages is the maximum size of the linear memory of each module
+	// instance, in 64 KiB pages. If zero, the wazero default of 65536 pages
+	// (4 GiB) is used.
+	MemoryLimitPages uint32
+
+	// Args are the command-line arguments passed to the module, including the
+	// program name.
+	Args []string
+
+	// Stderr receives the standard error of the module instances. If nil, it is
+	// discarded.
+	Stderr io.Writer
+
+	// Cache, if set, holds compiled code that can be shared between factories
+	// so that a module is only compiled once.
+	Cache wazero.CompilationCache
+}
+
+type invokerFactory struct {
+	runtime wazero.Runtime
+	module  wazero.CompiledModule
+	config  Config
+}
+
+// NewInvokerFactory compiles the WebAssembly module in wasm and returns a
+// factory that creates Invokers backed by instances of it.
+//
+// wazero does not meter instructions, so there is no fuel limit; instead, an
+// instance that is still running when the deadline of an invocation passes is
+// terminated, and the invocation returns the context error. The Invoker should
+// then be discarded, which an InvokerPool does automatically.
+//
+// The returned object also implements io.Closer; calling Close releases the
+// compiled module and terminates any instances that are still running. The
+// Invokers implement io.Closer as well.
+func NewInvokerFactory(wasm []byte, config Config) (fnrun.InvokerFactory, error) {
+	runtimeConfig := wazero.NewRuntimeConfig().WithCloseOnContextDone(true)
+	if config.MemoryLimitPages > 0 {
+		runtimeConfig = runtimeConfig.WithMemoryLimitPages(config.MemoryLimitPages)
+	}
+	if config.Cache != nil {
+		runtimeConfig = runtimeConfig.WithCompilationCache(config.Cache)
+	}
+
+	ctx := context.Background()
+	runtime := wazero.NewRuntimeWithConfig(ctx, runtimeConfig)
+
+	_, err := wasi_snapshot_preview1.Instantiate(ctx, runtime)
+	if err != nil {
+		runtime.Close(ctx)
+		return nil, err
+	}
+
+	module, err := runtime.CompileModule(ctx, wasm)
+	if err != nil {
+		runtime.Close(ctx)
+		return nil, err
+	}
+
+	factory := &invokerFactory{
+		runtime: runtime,
+		module:  module,
+		config:  config,
+	}
+
+	return factory, nil
+}
+
+func (factory *invokerFactory) NewInvoker() (fnrun.Invoker, error) {
+	stdinReader, stdinWriter := io.Pipe()
+	stdoutReader, stdoutWriter := io.Pipe()
+
+	stderr := factory.config.Stderr
+	if stderr == nil {
+		stderr = ioutil.Discard
+	}
+
+	moduleConfig := wazero.NewModuleConfig().
+		WithName("").
+		WithArgs(factory.config.Args...).
+		WithStdin(stdinReader).
+		WithStdout(stdoutWriter).
+		WithStderr(stderr).
+		WithSysWalltime().
+		WithSysNanotime().
+		WithSysNanosleep().
+		WithRandSource(rand.Reader)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	wi := &wasmInvoker{
+		stdin:  stdinWriter,
+		stdout: stdoutReader,
+		cancel: cancel,
+		exited: make(chan struct{}),
+	}
+
+	// The module runs its start function during instantiation, which returns
+	// when the module exits or ctx is canceled.
+	go func() {
+		module, _ := factory.runtime.InstantiateModule(ctx, factory.module, moduleConfig)
+		if module != nil {
+			module.Close(ctx)
+		}
+		stdinReader.CloseWithError(ErrModuleExited)
+		stdoutWriter.CloseWithError(ErrModuleExited)
+		close(wi.exited)
+	}()
+
+	return wi, nil
+}
+
+// Close releases the compiled module and terminates any running instances.
+func (factory *invokerFactory) Close() error {
+	return factory.runtime.Close(context.Background())
+}
+
+// wasmInvoker is an Invoker backed by a running module instance.
+type wasmInvoker struct {
+	stdin  *io.PipeWriter
+	stdout *io.PipeReader
+
+	// cancel terminates the module instance.
+	cancel context.CancelFunc
+
+	// exited is closed when the module instance stops running.
+	exited chan struct{}
+
+	closeOnce sync.Once
+}
+
+func (wi *wasmInvoker) Invoke(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+	if _, hasTimeout := ctx.Deadline(); !hasTimeout {
+		return nil, fnrun.ErrMissingTimeout
+	}
+
+	resultChan := make(chan *fnrun.Result, 1)
+	errChan := make(chan error, 1)
+
+	// Writes to the module block until it reads them, so the whole exchange
+	// happens in the background where the deadline can interrupt it.
+	go func() {
+		_, err := input.WriteTo(wi.stdin)
+		if err != nil {
+			errChan <- err
+			return
+		}
+
+		_, err = fnrun.WriteTo(ctx, wi.stdin)
+		if err != nil {
+			errChan <- err
+			return
+		}
+
+		result := &fnrun.Result{}
+		err = fnrun.ReadFrom(wi.stdout, result)
+		if err != nil {
+			errChan <- err
+			return
+		}
+		resultChan <- result
+	}()
+
+	select {
+	case result := <-resultChan:
+		return result, nil
+	case <-ctx.Done():
+		wi.kill()
+		return nil, ctx.Err()
+	case err := <-errChan:
+		wi.kill()
+		return nil, err
+	}
+}
+
+func (wi *wasmInvoker) kill() {
+	wi.cancel()
+	wi.stdin.CloseWithError(ErrModuleExited)
+	wi.stdout.CloseWithError(ErrModuleExited)
+}
+
+// Close closes the stdin of the module instance so that it can exit, and
+// terminates it if it is still running after closeGracePeriod.
+func (wi *wasmInvoker) Close() error {
+	wi.closeOnce.Do(func() {
+		wi.stdin.Close()
+
+		select {
+		case <-wi.exited:
+		case <-time.After(closeGracePeriod):
+		}
+
+		wi.kill()
+		<-wi.exited
+	})
+
+	return nil
+}
@@ -0,0 +1,161 @@
+package fnrunwasm
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/tessellator/fnrun"
+	"github.com/tetratelabs/wazero"
+)
+
+// greetingWasm holds the greeting test function compiled to WebAssembly by
+// TestMain.
+var greetingWasm []byte
+
+// cache avoids compiling greetingWasm to machine code in every test.
+var cache = wazero.NewCompilationCache()
+
+func TestMain(m *testing.M) {
+	os.Exit(runTests(m))
+}
+
+func runTests(m *testing.M) int {
+	dir, err := ioutil.TempDir("", "fnrunwasm")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "greeting.wasm")
+	cmd := exec.Command("go", "build", "-o", path, "./testdata/greeting")
+	cmd.Env = append(os.Environ(), "GOOS=wasip1", "GOARCH=wasm")
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		fmt.Fprintln(os.Stderr, "building test module:", err)
+		return 1
+	}
+
+	greetingWasm, err = ioutil.ReadFile(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	return m.Run()
+}
+
+func newInvoker(t *testing.T, config Config) fnrun.Invoker {
+	config.Cache = cache
+	factory, err := NewInvokerFactory(greetingWasm, config)
+	if err != nil {
+		t.Fatalf("NewInvokerFactory() returned err: %+v", err)
+	}
+	t.Cleanup(func() { factory.(io.Closer).Close() })
+
+	invoker, err := factory.NewInvoker()
+	if err != nil {
+		t.Fatalf("NewInvoker() returned err: %+v", err)
+	}
+	t.Cleanup(func() { invoker.(io.Closer).Close() })
+
+	return invoker
+}
+
+func TestInvoke(t *testing.T) {
+	invoker := newInvoker(t, Config{})
+
+	for _, name := range []string{"world", "again"} {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		result, err := invoker.Invoke(ctx, &fnrun.Input{Data: []byte(name)})
+		cancel()
+
+		if err != nil {
+			t.Fatalf("Invoke() returned err: %+v", err)
+		}
+
+		want := "Hello, " + name + "!"
+		if got := string(result.Data); got != want {
+			t.Errorf("Did not read expected result: got %s; want %s", got, want)
+		}
+	}
+}
+
+func TestInvoke_missingTimeout(t *testing.T) {
+	invoker := newInvoker(t, Config{})
+
+	_, err := invoker.Invoke(context.Background(), &fnrun.Input{})
+
+	if err != fnrun.ErrMissingTimeout {
+		t.Errorf("Expected missing timeout error, but got: %+v", err)
+	}
+}
+
+func TestInvoke_runTooLong(t *testing.T) {
+	invoker := newInvoker(t, Config{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	_, err := invoker.Invoke(ctx, &fnrun.Input{Data: []byte("spin")})
+
+	if err != context.DeadlineExceeded {
+		t.Errorf("Expected deadline exceeded error, but got: %+v", err)
+	}
+
+	select {
+	case <-invoker.(*wasmInvoker).exited:
+	case <-time.After(5 * time.Second):
+		t.Errorf("Expected the module instance to be terminated")
+	}
+}
+
+func TestInvoke_memoryLimit(t *testing.T) {
+	// 1024 pages is 64 MiB.
+	invoker := newInvoker(t, Config{MemoryLimitPages: 1024})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	_, err := invoker.Invoke(ctx, &fnrun.Input{Data: []byte("grow")})
+
+	if err == nil {
+		t.Errorf("Expected an error when the module exceeds its memory limit")
+	}
+}
+
+func TestNewInvokerFactory_invalidModule(t *testing.T) {
+	_, err := NewInvokerFactory([]byte("not wasm"), Config{})
+
+	if err == nil {
+		t.Errorf("NewInvokerFactory() did not return error")
+	}
+}
+
+func TestClose(t *testing.T) {
+	invoker := newInvoker(t, Config{})
+
+	invoker.(io.Closer).Close()
+
+	select {
+	case <-invoker.(*wasmInvoker).exited:
+	default:
+		t.Errorf("Expected the module instance to exit")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	_, err := invoker.Invoke(ctx, &fnrun.Input{})
+
+	if err == nil {
+		t.Errorf("Expected an error when invoking a closed invoker")
+	}
+}
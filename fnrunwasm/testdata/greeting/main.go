@@ -0,0 +1,39 @@
+// The greeting program is a WASI test function that greets the name it is
+// given. The names "spin" and "grow" make it loop forever or allocate memory
+// without bound.
+package main
+
+import (
+	"os"
+
+	"github.com/tessellator/fnrun/fnrun/protobufs"
+	protoio "github.com/tessellator/protoio"
+)
+
+func main() {
+	var hoard [][]byte
+
+	for {
+		ctx := protobufs.ExecutionContext{}
+		event := protobufs.Event{}
+
+		if err := protoio.Read(os.Stdin, &event); err != nil {
+			return
+		}
+		protoio.Read(os.Stdin, &ctx)
+
+		switch string(event.GetData()) {
+		case "spin":
+			for {
+			}
+		case "grow":
+			for {
+				hoard = append(hoard, make([]byte, 1<<20))
+			}
+		}
+
+		response := "Hello, " + string(event.GetData()) + "!"
+		result := protobufs.Result{Data: []byte(response)}
+		protoio.Write(os.Stdout, &result)
+	}
+}
@@ -0,0 +1,61 @@
+package fnrun
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+)
+
+// FuncInvoker is an Invoker that calls a Go function in the current process.
+//
+// It allows in-process functions, such as test doubles or trusted functions on
+// a hot path, to be used with InvokerPool and anything else that accepts an
+// Invoker without starting an OS process.
+//
+// A panic in the function is recovered and returned from Invoke as a
+// *PanicError. Go functions cannot be preempted, so the function is expected to
+// honor the deadline of the context it receives.
+type FuncInvoker func(context.Context, *Input) (*Result, error)
+
+// Invoke calls f with the provided context and input.
+func (f FuncInvoker) Invoke(ctx context.Context, input *Input) (result *Result, err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			result = nil
+			err = &PanicError{Value: v, Stack: debug.Stack()}
+		}
+	}()
+
+	return f(ctx, input)
+}
+
+// PanicError is an error that indicates that an in-process function panicked
+// during an invocation.
+type PanicError struct {
+	// Value is the value passed to panic.
+	Value interface{}
+
+	// Stack is the stack trace of the goroutine at the time of the panic.
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("function panicked: %v", e.Value)
+}
+
+type funcInvokerFactory struct {
+	fn FuncInvoker
+}
+
+// NewFuncInvokerFactory creates a factory whose invokers call fn.
+//
+// Every Invoker created by the factory calls the same function, so fn must be
+// safe for concurrent use if the invokers are used concurrently, as they are in
+// an InvokerPool with a MaxInvokerCount greater than one.
+func NewFuncInvokerFactory(fn func(context.Context, *Input) (*Result, error)) InvokerFactory {
+	return &funcInvokerFactory{fn: FuncInvoker(fn)}
+}
+
+func (factory *funcInvokerFactory) NewInvoker() (Invoker, error) {
+	return factory.fn, nil
+}
@@ -0,0 +1,93 @@
+package fnrun
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestFuncInvoker_Invoke(t *testing.T) {
+	invoker := FuncInvoker(func(ctx context.Context, input *Input) (*Result, error) {
+		return &Result{Data: []byte("Hello, " + string(input.Data) + "!")}, nil
+	})
+
+	result, err := invoker.Invoke(context.Background(), &Input{Data: []byte("world")})
+
+	if err != nil {
+		t.Fatalf("Invoke() returned err: %+v", err)
+	}
+
+	want := "Hello, world!"
+	if got := string(result.Data); got != want {
+		t.Errorf("Did not read expected result: got %s; want %s", got, want)
+	}
+}
+
+func TestFuncInvoker_Invoke_err(t *testing.T) {
+	invoker := FuncInvoker(func(context.Context, *Input) (*Result, error) {
+		return nil, ErrFake
+	})
+
+	_, err := invoker.Invoke(context.Background(), &Input{})
+
+	if err != ErrFake {
+		t.Errorf("Expected fake error, but got: %+v", err)
+	}
+}
+
+func TestFuncInvoker_Invoke_panic(t *testing.T) {
+	invoker := FuncInvoker(func(context.Context, *Input) (*Result, error) {
+		panic("oh no")
+	})
+
+	result, err := invoker.Invoke(context.Background(), &Input{})
+
+	panicErr, ok := err.(*PanicError)
+	if !ok {
+		t.Fatalf("Expected a panic error, but got: %+v", err)
+	}
+
+	if panicErr.Value != "oh no" {
+		t.Errorf("Expected panic value 'oh no', but got: %+v", panicErr.Value)
+	}
+
+	if len(panicErr.Stack) == 0 {
+		t.Errorf("Expected panic error to include a stack trace")
+	}
+
+	if result != nil {
+		t.Errorf("Expected result to be nil, but got: %+v", result)
+	}
+}
+
+func TestNewFuncInvokerFactory(t *testing.T) {
+	factory := NewFuncInvokerFactory(func(ctx context.Context, input *Input) (*Result, error) {
+		if _, hasTimeout := ctx.Deadline(); !hasTimeout {
+			return nil, ErrMissingTimeout
+		}
+		return &Result{Data: input.Data}, nil
+	})
+
+	config := InvokerPoolConfig{
+		MaxInvokerCount: 2,
+		InvokerFactory:  factory,
+		MaxWaitDuration: time.Second,
+		MaxRunnableTime: time.Second,
+	}
+	pool, err := NewInvokerPool(config)
+
+	if err != nil {
+		t.Fatalf("Creating invoker pool returned err: %+v", err)
+	}
+	defer pool.Close()
+
+	result, err := pool.Invoke(context.Background(), &Input{Data: []byte("echo")})
+
+	if err != nil {
+		t.Fatalf("Invoke() returned err: %+v", err)
+	}
+
+	if got := string(result.Data); got != "echo" {
+		t.Errorf("Did not read expected result: got %s; want echo", got)
+	}
+}
@@ -6,4 +6,6 @@ require (
 	github.com/golang/protobuf v1.4.3
 	github.com/tessellator/executil v0.1.0
 	github.com/tessellator/protoio v0.3.0
+	google.golang.org/grpc v1.33.2
+	gopkg.in/yaml.v2 v2.4.0
 )
@@ -0,0 +1,105 @@
+package fnrun
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// NewHTTPHandler creates an http.Handler that invokes invoker for each request
+// it receives.
+//
+// The request body is passed as the Input data. The request is described to
+// the function through environment variables on the execution context, using
+// names borrowed from CGI: REQUEST_METHOD, PATH_INFO and QUERY_STRING hold the
+// method, path and raw query, and each header is provided as HTTP_ followed by
+// the upper-cased header name with dashes replaced by underscores (for example,
+// HTTP_CONTENT_TYPE). Repeated headers are joined with ", ".
+//
+// The Result status is used as the HTTP status code, with zero treated as 200
+// OK, and the Result env is written as response headers. An
+// ErrAvailabilityTimeout or ErrPoolClosed error results in a 503 Service
+// Unavailable response, a context deadline results in a 504 Gateway Timeout
+// response, and any other error results in a 500 Internal Server Error
+// response.
+//
+// The request context does not have a timeout, so invoker is expected to apply
+// one; an InvokerPool does this based on its MaxRunnableTime.
+func NewHTTPHandler(invoker Invoker) http.Handler {
+	return &httpHandler{invoker: invoker}
+}
+
+type httpHandler struct {
+	invoker Invoker
+}
+
+func (h *httpHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeHTTPError(w, http.StatusBadRequest)
+		return
+	}
+
+	ctx := WithEnv(r.Context(), requestEnv(r))
+	result, err := h.invoker.Invoke(ctx, &Input{Data: data})
+	if err != nil {
+		writeHTTPError(w, httpStatusForError(err))
+		return
+	}
+
+	writeHTTPResult(w, result)
+}
+
+// writeHTTPResult writes result as an HTTP response, using the Result env as
+// response headers.
+func writeHTTPResult(w http.ResponseWriter, result *Result) {
+	for name, value := range result.Env {
+		w.Header().Set(name, value)
+	}
+	w.WriteHeader(httpStatusForResult(result))
+	w.Write(result.Data)
+}
+
+// requestEnv builds the environment variables that describe r.
+func requestEnv(r *http.Request) map[string]string {
+	env := map[string]string{
+		"REQUEST_METHOD": r.Method,
+		"PATH_INFO":      r.URL.Path,
+		"QUERY_STRING":   r.URL.RawQuery,
+	}
+
+	for name, values := range r.Header {
+		key := "HTTP_" + strings.ToUpper(strings.Replace(name, "-", "_", -1))
+		env[key] = strings.Join(values, ", ")
+	}
+
+	return env
+}
+
+func httpStatusForResult(result *Result) int {
+	if result.Status == 0 {
+		return http.StatusOK
+	}
+
+	if result.Status < 100 || result.Status > 599 {
+		return http.StatusInternalServerError
+	}
+
+	return result.Status
+}
+
+func httpStatusForError(err error) int {
+	switch err {
+	case ErrAvailabilityTimeout, ErrPoolClosed:
+		return http.StatusServiceUnavailable
+	case context.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func writeHTTPError(w http.ResponseWriter, status int) {
+	http.Error(w, http.StatusText(status), status)
+}
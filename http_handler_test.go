@@ -0,0 +1,86 @@
+package fnrun
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHTTPHandler_ServeHTTP(t *testing.T) {
+	invoker := FuncInvoker(func(ctx context.Context, input *Input) (*Result, error) {
+		env, _ := Env(ctx)
+		result := &Result{
+			Status: http.StatusCreated,
+			Data:   append([]byte("got "), input.Data...),
+			Env: map[string]string{
+				"X-Method": env["REQUEST_METHOD"],
+				"X-Path":   env["PATH_INFO"],
+				"X-Query":  env["QUERY_STRING"],
+				"X-Custom": env["HTTP_X_CUSTOM_HEADER"],
+			},
+		}
+		return result, nil
+	})
+
+	req := httptest.NewRequest("PUT", "/greet?name=world", strings.NewReader("hello"))
+	req.Header.Set("X-Custom-Header", "custom")
+	rec := httptest.NewRecorder()
+
+	NewHTTPHandler(invoker).ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusCreated {
+		t.Errorf("Expected status %d, but got %d", http.StatusCreated, rec.Code)
+	}
+
+	if body := rec.Body.String(); body != "got hello" {
+		t.Errorf("Expected body 'got hello', but got %q", body)
+	}
+
+	headers := map[string]string{
+		"X-Method": "PUT",
+		"X-Path":   "/greet",
+		"X-Query":  "name=world",
+		"X-Custom": "custom",
+	}
+	for name, want := range headers {
+		if got := rec.Header().Get(name); got != want {
+			t.Errorf("Header %s: got %q; want %q", name, got, want)
+		}
+	}
+}
+
+func TestHTTPHandler_ServeHTTP_status(t *testing.T) {
+	tests := []struct {
+		name   string
+		result *Result
+		err    error
+		want   int
+	}{
+		{"zero status", &Result{}, nil, http.StatusOK},
+		{"invalid status", &Result{Status: 1}, nil, http.StatusInternalServerError},
+		{"availability timeout", nil, ErrAvailabilityTimeout, http.StatusServiceUnavailable},
+		{"pool closed", nil, ErrPoolClosed, http.StatusServiceUnavailable},
+		{"deadline exceeded", nil, context.DeadlineExceeded, http.StatusGatewayTimeout},
+		{"other error", nil, errors.New("boom"), http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			invoker := FuncInvoker(func(context.Context, *Input) (*Result, error) {
+				return tt.result, tt.err
+			})
+
+			req := httptest.NewRequest("GET", "/", nil)
+			rec := httptest.NewRecorder()
+
+			NewHTTPHandler(invoker).ServeHTTP(rec, req)
+
+			if rec.Code != tt.want {
+				t.Errorf("Expected status %d, but got %d", tt.want, rec.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package fnrun
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// httpEnvHeader is the request header that carries the environment
+	// variables of an invocation to a remote endpoint as a JSON object.
+	httpEnvHeader = "Fnrun-Env"
+
+	// httpDeadlineHeader is the request header that carries the deadline of an
+	// invocation to a remote endpoint.
+	httpDeadlineHeader = "Fnrun-Deadline"
+)
+
+type httpInvoker struct {
+	url    string
+	client *http.Client
+}
+
+// NewHTTPInvoker creates an Invoker that forwards invocations to a remote HTTP
+// endpoint at url.
+//
+// Each invocation is sent as a POST request with the Input data as the body.
+// Environment variables on the context are sent in the Fnrun-Env header as a
+// JSON object that maps each name to its value, which preserves names that
+// header names cannot. The context deadline is sent in the Fnrun-Deadline
+// header in RFC 3339 format so that the endpoint can honor it.
+// The request is canceled if the deadline passes.
+//
+// The Result status is the HTTP status code of the response, the Result env
+// contains the response headers, with repeated headers joined by ", ", and the
+// Result data is the response body.
+//
+// If client is nil, http.DefaultClient is used.
+func NewHTTPInvoker(url string, client *http.Client) Invoker {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return &httpInvoker{url: url, client: client}
+}
+
+func (hi *httpInvoker) Invoke(ctx context.Context, input *Input) (*Result, error) {
+	deadline, hasTimeout := ctx.Deadline()
+	if !hasTimeout {
+		return nil, ErrMissingTimeout
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hi.url, bytes.NewReader(input.Data))
+	if err != nil {
+		return nil, err
+	}
+
+	if env, hasEnv := Env(ctx); hasEnv && len(env) > 0 {
+		encoded, err := json.Marshal(env)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set(httpEnvHeader, string(encoded))
+	}
+	req.Header.Set(httpDeadlineHeader, deadline.Format(time.RFC3339Nano))
+
+	resp, err := hi.client.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+
+	result := &Result{
+		Status: resp.StatusCode,
+		Data:   data,
+		Env:    make(map[string]string, len(resp.Header)),
+	}
+	for name, values := range resp.Header {
+		result.Env[name] = strings.Join(values, ", ")
+	}
+
+	return result, nil
+}
+
+type httpInvokerFactory struct {
+	url    string
+	client *http.Client
+}
+
+// NewHTTPInvokerFactory creates a factory that creates Invokers for the remote
+// HTTP endpoint at url, as by NewHTTPInvoker.
+//
+// When used with an InvokerPool, the MaxInvokerCount of the pool limits the
+// number of concurrent requests to the endpoint.
+func NewHTTPInvokerFactory(url string, client *http.Client) InvokerFactory {
+	return &httpInvokerFactory{url: url, client: client}
+}
+
+func (factory *httpInvokerFactory) NewInvoker() (Invoker, error) {
+	return NewHTTPInvoker(factory.url, factory.client), nil
+}
@@ -0,0 +1,128 @@
+package fnrun
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHTTPInvoker_Invoke(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+
+		if _, err := time.Parse(time.RFC3339Nano, r.Header.Get("Fnrun-Deadline")); err != nil {
+			t.Errorf("Expected a valid deadline header, but got err: %+v", err)
+		}
+
+		// Read the raw header keys so that canonicalization cannot hide
+		// mangled names.
+		values := r.Header["Fnrun-Env"]
+		if len(values) != 1 {
+			t.Fatalf("Expected one Fnrun-Env header, but got headers: %v", r.Header)
+		}
+		var env map[string]string
+		if err := json.Unmarshal([]byte(values[0]), &env); err != nil {
+			t.Fatalf("Expected a JSON env header, but got err: %+v", err)
+		}
+		if env["myVar"] != "mixed case" || env["HTTP_X_CUSTOM"] != "underscores" || env["with space"] != "x\ny" {
+			t.Errorf("Did not receive expected env: %+v", env)
+		}
+
+		w.Header().Set("X-Method", r.Method)
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte(env["GREETING"] + ", " + string(body) + "!"))
+	}))
+	defer server.Close()
+
+	ctx := WithEnv(context.Background(), map[string]string{
+		"GREETING":      "Hello",
+		"myVar":         "mixed case",
+		"HTTP_X_CUSTOM": "underscores",
+		"with space":    "x\ny",
+	})
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	invoker := NewHTTPInvoker(server.URL, nil)
+	result, err := invoker.Invoke(ctx, &Input{Data: []byte("world")})
+
+	if err != nil {
+		t.Fatalf("Invoke() returned err: %+v", err)
+	}
+
+	if result.Status != http.StatusAccepted {
+		t.Errorf("Expected status %d, but got %d", http.StatusAccepted, result.Status)
+	}
+
+	if method := result.Env["X-Method"]; method != "POST" {
+		t.Errorf("Expected X-Method env to be POST, but got %q", method)
+	}
+
+	want := "Hello, world!"
+	if got := string(result.Data); got != want {
+		t.Errorf("Did not read expected result: got %s; want %s", got, want)
+	}
+}
+
+func TestHTTPInvoker_Invoke_runTooLong(t *testing.T) {
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-done:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(done)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+
+	_, err := NewHTTPInvoker(server.URL, nil).Invoke(ctx, &Input{})
+
+	if err != context.DeadlineExceeded {
+		t.Errorf("Expected deadline exceeded error but got: %+v", err)
+	}
+}
+
+func TestHTTPInvoker_Invoke_missingTimeout(t *testing.T) {
+	_, err := NewHTTPInvoker("http://127.0.0.1:0", nil).Invoke(context.Background(), &Input{})
+
+	if err != ErrMissingTimeout {
+		t.Errorf("Expected missing timeout error but got: %+v", err)
+	}
+}
+
+func TestNewHTTPInvokerFactory(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("remote"))
+	}))
+	defer server.Close()
+
+	config := InvokerPoolConfig{
+		MaxInvokerCount: 2,
+		InvokerFactory:  NewHTTPInvokerFactory(server.URL, server.Client()),
+		MaxWaitDuration: time.Second,
+		MaxRunnableTime: 30 * time.Second,
+	}
+	pool, err := NewInvokerPool(config)
+
+	if err != nil {
+		t.Fatalf("Creating invoker pool returned err: %+v", err)
+	}
+	defer pool.Close()
+
+	result, err := pool.Invoke(context.Background(), &Input{})
+
+	if err != nil {
+		t.Fatalf("Invoke() returned err: %+v", err)
+	}
+
+	if got := string(result.Data); got != "remote" {
+		t.Errorf("Did not read expected result: got %s; want remote", got)
+	}
+}
@@ -4,10 +4,6 @@ import (
 	"context"
 	"errors"
 	"io"
-
-	tspb "github.com/golang/protobuf/ptypes"
-	"github.com/tessellator/fnrun/fnrun/protobufs"
-	"github.com/tessellator/protoio"
 )
 
 // ErrMissingTimeout exists to signal that an code is attempting to call an
@@ -22,6 +18,7 @@ type ctxKey int
 
 const (
 	ctxEnvKey ctxKey = iota
+	ctxSplitKey
 )
 
 // Invoker represents something that can be called with an input and context
@@ -61,30 +58,10 @@ func Env(ctx context.Context) (map[string]string, bool) {
 }
 
 // WriteTo writes the ExecutionContext to the specified writer.
+//
+// It is encoded with ProtobufCodec.
 func WriteTo(ctx context.Context, w io.Writer) (int64, error) {
-	envVars := []*protobufs.EnvironmentVariable{}
-	env, hasEnv := Env(ctx)
-	if hasEnv {
-		for k, v := range env {
-			envVars = append(envVars, &protobufs.EnvironmentVariable{Name: k, Value: v})
-		}
-	}
-
-	stopTime, hasTimeout := ctx.Deadline()
-	if !hasTimeout {
-		return 0, ErrMissingTimeout
-	}
-	stopTimeProto, err := tspb.TimestampProto(stopTime)
-	if err != nil {
-		return 0, err
-	}
-
-	protoCtx := protobufs.ExecutionContext{
-		EnvVars:  envVars,
-		StopTime: stopTimeProto,
-	}
-
-	return protoio.Write(w, &protoCtx)
+	return ProtobufCodec.WriteExecutionContext(ctx, w)
 }
 
 // Input contains the data that is passed to an invocation.
@@ -96,12 +73,10 @@ type Input struct {
 }
 
 // WriteTo writes the Input to the specified writer.
+//
+// It is encoded with ProtobufCodec.
 func (input *Input) WriteTo(w io.Writer) (int64, error) {
-	pInput := protobufs.Event{
-		Data: input.Data,
-	}
-
-	return protoio.Write(w, &pInput)
+	return ProtobufCodec.WriteEvent(w, input)
 }
 
 // Result represents the result of an invocation.
@@ -125,21 +100,8 @@ type Result struct {
 
 // ReadFrom reads a Result from the specified reader and populates the specified
 // result.
+//
+// It is decoded with ProtobufCodec.
 func ReadFrom(r io.Reader, result *Result) error {
-	pResult := protobufs.Result{}
-	err := protoio.Read(r, &pResult)
-	if err != nil {
-		return err
-	}
-
-	env := make(map[string]string)
-	for _, envVar := range pResult.GetEnvVars() {
-		env[envVar.GetName()] = envVar.GetValue()
-	}
-
-	result.Status = int(pResult.GetStatus())
-	result.Data = pResult.GetData()
-	result.Env = env
-
-	return nil
+	return ProtobufCodec.ReadResult(r, result)
 }
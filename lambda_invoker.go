@@ -0,0 +1,314 @@
+package fnrun
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tessellator/executil"
+)
+
+const (
+	// lambdaRuntimeAPIEnvVar is the environment variable that tells a Lambda
+	// custom runtime where to find the Runtime API.
+	lambdaRuntimeAPIEnvVar = "AWS_LAMBDA_RUNTIME_API"
+
+	lambdaRuntimePathPrefix = "/2018-06-01/runtime/"
+
+	// LambdaErrorStatus is the Result status used when a function reports an
+	// error through the Runtime API.
+	LambdaErrorStatus = http.StatusInternalServerError
+
+	// LambdaErrorTypeEnvVar is the Result env key that holds the error type a
+	// function reported through the Runtime API. The name matches the header
+	// used by the Lambda Invoke API.
+	LambdaErrorTypeEnvVar = "X-Amz-Function-Error"
+)
+
+// ErrLambdaRuntimeExited is an error that indicates that a Lambda runtime
+// process exited or reported an initialization error.
+var ErrLambdaRuntimeExited = errors.New("lambda runtime is no longer running")
+
+type lambdaInvokerFactory struct {
+	cmd *exec.Cmd
+}
+
+// NewLambdaInvokerFactory creates a factory that runs Lambda custom runtime
+// bootstrap programs, such as those built for the provided.al2 runtime, as
+// Invokers.
+//
+// Each Invoker starts a copy of cmd with AWS_LAMBDA_RUNTIME_API pointing at an
+// embedded HTTP server that implements the next invocation, invocation
+// response, invocation error and initialization error endpoints of the Lambda
+// Runtime API.
+//
+// The Input data is the event payload, the context deadline is reported in the
+// Lambda-Runtime-Deadline-Ms header, and any environment variables on the
+// context are sent as the custom values of the Lambda-Runtime-Client-Context
+// header. A response produces a Result with a 200 status; an invocation error
+// produces a Result with LambdaErrorStatus, the error document as data, and the
+// reported error type under LambdaErrorTypeEnvVar.
+//
+// The cmd will be cloned for each new Invoker. The Invokers implement
+// io.Closer.
+func NewLambdaInvokerFactory(cmd *exec.Cmd) InvokerFactory {
+	return &lambdaInvokerFactory{cmd: cmd}
+}
+
+func (factory *lambdaInvokerFactory) NewInvoker() (Invoker, error) {
+	return newLambdaInvoker(executil.CloneCmd(factory.cmd))
+}
+
+// lambdaInvocation is an invocation waiting to be picked up or completed by a
+// Lambda runtime.
+type lambdaInvocation struct {
+	id       string
+	input    *Input
+	deadline time.Time
+	env      map[string]string
+	result   chan *Result
+}
+
+type lambdaInvoker struct {
+	cmd    *exec.Cmd
+	server *http.Server
+
+	// next hands invocations to the handler serving a pending next request.
+	next chan *lambdaInvocation
+
+	// exited is closed when the runtime exits or fails to initialize.
+	exited     chan struct{}
+	exitOnce   sync.Once
+	waitResult chan struct{}
+
+	mu      sync.Mutex
+	current *lambdaInvocation
+
+	closeOnce sync.Once
+}
+
+func newLambdaInvoker(cmd *exec.Cmd) (*lambdaInvoker, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	li := &lambdaInvoker{
+		cmd:        cmd,
+		next:       make(chan *lambdaInvocation),
+		exited:     make(chan struct{}),
+		waitResult: make(chan struct{}),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(lambdaRuntimePathPrefix+"invocation/next", li.handleNext)
+	mux.HandleFunc(lambdaRuntimePathPrefix+"invocation/", li.handleInvocation)
+	mux.HandleFunc(lambdaRuntimePathPrefix+"init/error", li.handleInitError)
+	li.server = &http.Server{Handler: mux}
+
+	appendEnv(cmd, lambdaRuntimeAPIEnvVar+"="+listener.Addr().String())
+
+	err = cmd.Start()
+	if err != nil {
+		listener.Close()
+		return nil, err
+	}
+
+	go li.server.Serve(listener)
+	go func() {
+		cmd.Wait()
+		li.markExited()
+		close(li.waitResult)
+	}()
+
+	return li, nil
+}
+
+func (li *lambdaInvoker) Invoke(ctx context.Context, input *Input) (*Result, error) {
+	deadline, hasTimeout := ctx.Deadline()
+	if !hasTimeout {
+		return nil, ErrMissingTimeout
+	}
+
+	env, _ := Env(ctx)
+	invocation := &lambdaInvocation{
+		id:       randomID(),
+		input:    input,
+		deadline: deadline,
+		env:      env,
+		result:   make(chan *Result, 1),
+	}
+
+	li.mu.Lock()
+	li.current = invocation
+	li.mu.Unlock()
+
+	defer func() {
+		li.mu.Lock()
+		li.current = nil
+		li.mu.Unlock()
+	}()
+
+	select {
+	case li.next <- invocation:
+	case <-ctx.Done():
+		li.kill()
+		return nil, ctx.Err()
+	case <-li.exited:
+		return nil, ErrLambdaRuntimeExited
+	}
+
+	select {
+	case result := <-invocation.result:
+		return result, nil
+	case <-ctx.Done():
+		li.kill()
+		return nil, ctx.Err()
+	case <-li.exited:
+		return nil, ErrLambdaRuntimeExited
+	}
+}
+
+// handleNext serves GET /runtime/invocation/next by waiting for an invocation.
+func (li *lambdaInvoker) handleNext(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	var invocation *lambdaInvocation
+	select {
+	case invocation = <-li.next:
+	case <-r.Context().Done():
+		return
+	case <-li.exited:
+		return
+	}
+
+	header := w.Header()
+	header.Set("Lambda-Runtime-Aws-Request-Id", invocation.id)
+	header.Set("Lambda-Runtime-Deadline-Ms", strconv.FormatInt(invocation.deadline.UnixNano()/int64(time.Millisecond), 10))
+	if len(invocation.env) > 0 {
+		clientContext, err := json.Marshal(map[string]interface{}{"custom": invocation.env})
+		if err == nil {
+			header.Set("Lambda-Runtime-Client-Context", string(clientContext))
+		}
+	}
+	header.Set("Content-Type", "application/json")
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(invocation.input.Data)
+}
+
+// handleInvocation serves POST /runtime/invocation/{id}/response and
+// POST /runtime/invocation/{id}/error.
+func (li *lambdaInvoker) handleInvocation(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, lambdaRuntimePathPrefix+"invocation/"), "/")
+	if len(parts) != 2 || (parts[1] != "response" && parts[1] != "error") {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	li.mu.Lock()
+	invocation := li.current
+	li.mu.Unlock()
+
+	if invocation == nil || invocation.id != parts[0] {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	result := &Result{Status: http.StatusOK, Data: body, Env: map[string]string{}}
+	if parts[1] == "error" {
+		result.Status = LambdaErrorStatus
+		result.Env[LambdaErrorTypeEnvVar] = lambdaErrorType(r, body)
+	}
+
+	select {
+	case invocation.result <- result:
+		w.WriteHeader(http.StatusAccepted)
+	default:
+		// The invocation has already been completed.
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+// handleInitError serves POST /runtime/init/error. The runtime is considered
+// unusable after it reports an initialization error.
+func (li *lambdaInvoker) handleInitError(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	li.markExited()
+	li.kill()
+}
+
+func (li *lambdaInvoker) markExited() {
+	li.exitOnce.Do(func() { close(li.exited) })
+}
+
+func (li *lambdaInvoker) kill() {
+	li.cmd.Process.Kill()
+}
+
+// Close shuts down the Runtime API server, which causes a well-behaved runtime
+// to exit, and kills the runtime if it is still running after
+// closeGracePeriod.
+func (li *lambdaInvoker) Close() error {
+	li.closeOnce.Do(func() {
+		li.server.Close()
+
+		select {
+		case <-li.waitResult:
+		case <-time.After(closeGracePeriod):
+			li.kill()
+			<-li.waitResult
+		}
+	})
+
+	return nil
+}
+
+func (li *lambdaInvoker) residentSetSize() (int64, error) {
+	return readRSS(li.cmd.Process.Pid)
+}
+
+// lambdaErrorType determines the error type of an invocation error from the
+// Lambda-Runtime-Function-Error-Type header or the errorType field of the
+// error document.
+func lambdaErrorType(r *http.Request, body []byte) string {
+	if errorType := r.Header.Get("Lambda-Runtime-Function-Error-Type"); errorType != "" {
+		return errorType
+	}
+
+	var document struct {
+		ErrorType string `json:"errorType"`
+	}
+	if json.Unmarshal(body, &document) == nil && document.ErrorType != "" {
+		return document.ErrorType
+	}
+
+	return "Unhandled"
+}
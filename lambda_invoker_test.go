@@ -0,0 +1,161 @@
+package fnrun
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+func TestLambdaInvoker_Invoke(t *testing.T) {
+	invoker := newTestLambdaInvoker(t, "Test_LambdaBootstrapSubprocess")
+	defer invoker.(io.Closer).Close()
+
+	for _, name := range []string{"world", "again"} {
+		ctx := WithEnv(context.Background(), map[string]string{"GREETING": "Hello"})
+		ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		defer cancel()
+
+		result, err := invoker.Invoke(ctx, &Input{Data: []byte(name)})
+
+		if err != nil {
+			t.Fatalf("Invoke() returned err: %+v", err)
+		}
+
+		if result.Status != http.StatusOK {
+			t.Errorf("Expected status %d, but got %d", http.StatusOK, result.Status)
+		}
+
+		want := "Hello, " + name + "!"
+		if got := string(result.Data); got != want {
+			t.Errorf("Did not read expected result: got %s; want %s", got, want)
+		}
+	}
+}
+
+func TestLambdaInvoker_Invoke_functionError(t *testing.T) {
+	invoker := newTestLambdaInvoker(t, "Test_LambdaBootstrapSubprocess")
+	defer invoker.(io.Closer).Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	result, err := invoker.Invoke(ctx, &Input{Data: []byte("fail")})
+
+	if err != nil {
+		t.Fatalf("Invoke() returned err: %+v", err)
+	}
+
+	if result.Status != LambdaErrorStatus {
+		t.Errorf("Expected status %d, but got %d", LambdaErrorStatus, result.Status)
+	}
+
+	if errorType := result.Env[LambdaErrorTypeEnvVar]; errorType != "TestError" {
+		t.Errorf("Expected error type TestError, but got %q", errorType)
+	}
+}
+
+func TestLambdaInvoker_Invoke_runTooLong(t *testing.T) {
+	invoker := newTestLambdaInvoker(t, "Test_LambdaBootstrapSubprocess")
+	defer invoker.(io.Closer).Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err := invoker.Invoke(ctx, &Input{Data: []byte("sleep")})
+
+	if err != context.DeadlineExceeded {
+		t.Errorf("Expected deadline exceeded error but got: %+v", err)
+	}
+}
+
+func TestLambdaInvoker_Invoke_missingTimeout(t *testing.T) {
+	invoker := newTestLambdaInvoker(t, "Test_LambdaBootstrapSubprocess")
+	defer invoker.(io.Closer).Close()
+
+	_, err := invoker.Invoke(context.Background(), &Input{})
+
+	if err != ErrMissingTimeout {
+		t.Errorf("Expected missing timeout error but got: %+v", err)
+	}
+}
+
+func TestLambdaInvoker_Invoke_initError(t *testing.T) {
+	invoker := newTestLambdaInvoker(t, "Test_LambdaInitErrorSubprocess")
+	defer invoker.(io.Closer).Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	_, err := invoker.Invoke(ctx, &Input{})
+
+	if err != ErrLambdaRuntimeExited {
+		t.Errorf("Expected runtime exited error but got: %+v", err)
+	}
+}
+
+func newTestLambdaInvoker(t *testing.T, subprocess string) Invoker {
+	t.Helper()
+
+	cmd := exec.Command(os.Args[0], "-test.run="+subprocess)
+	cmd.Env = append(os.Environ(), "GO_RUNNING_SUBPROCESS=1")
+
+	invoker, err := NewLambdaInvokerFactory(cmd).NewInvoker()
+	if err != nil {
+		t.Fatalf("NewInvoker() returned error: %+v", err)
+	}
+
+	return invoker
+}
+
+// -----------------------------------------------------------------------------
+// Following are Lambda custom runtime subprocesses used for testing.
+
+func Test_LambdaBootstrapSubprocess(t *testing.T) {
+	if os.Getenv("GO_RUNNING_SUBPROCESS") != "1" {
+		return
+	}
+
+	api := "http://" + os.Getenv("AWS_LAMBDA_RUNTIME_API") + "/2018-06-01/runtime/invocation/"
+	for {
+		resp, err := http.Get(api + "next")
+		if err != nil {
+			return
+		}
+		data, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		id := resp.Header.Get("Lambda-Runtime-Aws-Request-Id")
+
+		var clientContext struct {
+			Custom map[string]string `json:"custom"`
+		}
+		json.Unmarshal([]byte(resp.Header.Get("Lambda-Runtime-Client-Context")), &clientContext)
+
+		switch string(data) {
+		case "fail":
+			body := `{"errorMessage":"failed","errorType":"TestError"}`
+			http.Post(api+id+"/error", "application/json", bytes.NewBufferString(body))
+		case "sleep":
+			<-time.After(200 * time.Millisecond)
+		default:
+			body := clientContext.Custom["GREETING"] + ", " + string(data) + "!"
+			http.Post(api+id+"/response", "text/plain", bytes.NewBufferString(body))
+		}
+	}
+}
+
+func Test_LambdaInitErrorSubprocess(t *testing.T) {
+	if os.Getenv("GO_RUNNING_SUBPROCESS") != "1" {
+		return
+	}
+
+	url := "http://" + os.Getenv("AWS_LAMBDA_RUNTIME_API") + "/2018-06-01/runtime/init/error"
+	body := `{"errorMessage":"could not initialize","errorType":"InitError"}`
+	http.Post(url, "application/json", bytes.NewBufferString(body))
+}
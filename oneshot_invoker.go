@@ -0,0 +1,143 @@
+package fnrun
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os/exec"
+	"strings"
+
+	"github.com/tessellator/executil"
+)
+
+// OneShotInvokerConfig contains the configuration data for invokers created by
+// NewOneShotInvoker and NewOneShotInvokerFactory.
+type OneShotInvokerConfig struct {
+	// ParseHeaders indicates that the output of the process starts with
+	// "Key: value" header lines, as in CGI, followed by a blank line and the
+	// data. The headers are returned in the Result env. If the output has no
+	// blank line, all of it is treated as headers.
+	ParseHeaders bool
+}
+
+type oneShotInvoker struct {
+	cmd    *exec.Cmd
+	config OneShotInvokerConfig
+}
+
+// NewOneShotInvoker creates an Invoker that starts a new copy of cmd for each
+// invocation, for programs that cannot serve more than one request.
+//
+// The Input data is written to the stdin of the process, which is then closed,
+// and any environment variables on the context are added to the environment of
+// the process. The stdout of the process becomes the Result data, and its exit
+// code becomes the Result status. If the process is killed by a signal, an
+// error is returned instead.
+//
+// The process is killed if it is still running when the context is done, in
+// which case the context error is returned. On Unix systems the process is
+// started in its own process group, and the whole group is killed, so that
+// processes it started cannot hold its output open past the deadline. Because
+// no process outlives an invocation, the Invoker can be reused after an error.
+func NewOneShotInvoker(cmd *exec.Cmd, config OneShotInvokerConfig) Invoker {
+	return &oneShotInvoker{cmd: cmd, config: config}
+}
+
+func (oi *oneShotInvoker) Invoke(ctx context.Context, input *Input) (*Result, error) {
+	if _, hasTimeout := ctx.Deadline(); !hasTimeout {
+		return nil, ErrMissingTimeout
+	}
+
+	cmd := executil.CloneCmd(oi.cmd)
+	cmd.Stderr = oi.cmd.Stderr
+	setProcessGroup(cmd)
+
+	env, _ := Env(ctx)
+	for k, v := range env {
+		appendEnv(cmd, k+"="+v)
+	}
+
+	stdout := &bytes.Buffer{}
+	cmd.Stdin = bytes.NewReader(input.Data)
+	cmd.Stdout = stdout
+
+	err := cmd.Start()
+	if err != nil {
+		return nil, err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		killProcessGroup(cmd)
+		<-done
+		return nil, ctx.Err()
+	}
+
+	status := 0
+	if err != nil {
+		exitErr, ok := err.(*exec.ExitError)
+		if !ok || exitErr.ExitCode() < 0 {
+			return nil, err
+		}
+		status = exitErr.ExitCode()
+	}
+
+	result := &Result{Status: status, Data: stdout.Bytes(), Env: map[string]string{}}
+	if oi.config.ParseHeaders {
+		result.Env, result.Data, err = parseHeaders(result.Data)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// parseHeaders splits output into "Key: value" header lines and the data that
+// follows the first blank line.
+func parseHeaders(output []byte) (map[string]string, []byte, error) {
+	headers := make(map[string]string)
+
+	for len(output) > 0 {
+		var line []byte
+		if i := bytes.IndexByte(output, '\n'); i >= 0 {
+			line, output = output[:i], output[i+1:]
+		} else {
+			line, output = output, nil
+		}
+		line = bytes.TrimSuffix(line, []byte("\r"))
+
+		if len(line) == 0 {
+			break
+		}
+
+		i := bytes.IndexByte(line, ':')
+		if i <= 0 {
+			return nil, nil, errors.New("invalid header line: " + string(line))
+		}
+		headers[strings.TrimSpace(string(line[:i]))] = strings.TrimSpace(string(line[i+1:]))
+	}
+
+	return headers, output, nil
+}
+
+type oneShotInvokerFactory struct {
+	cmd    *exec.Cmd
+	config OneShotInvokerConfig
+}
+
+// NewOneShotInvokerFactory creates a factory whose invokers start a new copy
+// of cmd for each invocation, as described by NewOneShotInvoker.
+func NewOneShotInvokerFactory(cmd *exec.Cmd, config OneShotInvokerConfig) InvokerFactory {
+	return &oneShotInvokerFactory{cmd: cmd, config: config}
+}
+
+func (factory *oneShotInvokerFactory) NewInvoker() (Invoker, error) {
+	return NewOneShotInvoker(factory.cmd, factory.config), nil
+}
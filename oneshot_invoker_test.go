@@ -0,0 +1,142 @@
+package fnrun
+
+import (
+	"context"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+func TestOneShotInvoker_Invoke(t *testing.T) {
+	cmd := exec.Command("sh", "-c", `printf '%s, ' "$GREETING"; cat; exit 3`)
+	invoker := NewOneShotInvoker(cmd, OneShotInvokerConfig{})
+
+	for i := 0; i < 2; i++ {
+		ctx := WithEnv(context.Background(), map[string]string{"GREETING": "Hello"})
+		ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		result, err := invoker.Invoke(ctx, &Input{Data: []byte("world")})
+		cancel()
+
+		if err != nil {
+			t.Fatalf("Invoke() returned err: %+v", err)
+		}
+
+		want := "Hello, world"
+		if got := string(result.Data); got != want {
+			t.Errorf("Did not read expected result: got %s; want %s", got, want)
+		}
+
+		if result.Status != 3 {
+			t.Errorf("Expected status 3, but got: %d", result.Status)
+		}
+	}
+}
+
+func TestOneShotInvoker_Invoke_parseHeaders(t *testing.T) {
+	script := `printf 'Content-Type: text/plain\r\nX-Count:  2 \r\n\r\nbody\n\nmore'`
+	invoker := NewOneShotInvoker(exec.Command("sh", "-c", script), OneShotInvokerConfig{ParseHeaders: true})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	result, err := invoker.Invoke(ctx, &Input{})
+
+	if err != nil {
+		t.Fatalf("Invoke() returned err: %+v", err)
+	}
+
+	if result.Env["Content-Type"] != "text/plain" || result.Env["X-Count"] != "2" {
+		t.Errorf("Did not parse expected headers: %+v", result.Env)
+	}
+
+	want := "body\n\nmore"
+	if got := string(result.Data); got != want {
+		t.Errorf("Did not read expected result: got %q; want %q", got, want)
+	}
+}
+
+func TestOneShotInvoker_Invoke_invalidHeaders(t *testing.T) {
+	invoker := NewOneShotInvoker(exec.Command("sh", "-c", "echo not a header"), OneShotInvokerConfig{ParseHeaders: true})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	_, err := invoker.Invoke(ctx, &Input{})
+
+	if err == nil {
+		t.Errorf("Expected an error for invalid header lines")
+	}
+}
+
+func TestOneShotInvoker_Invoke_runTooLong(t *testing.T) {
+	invoker := NewOneShotInvoker(exec.Command("sleep", "5"), OneShotInvokerConfig{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := invoker.Invoke(ctx, &Input{})
+
+	if err != context.DeadlineExceeded {
+		t.Errorf("Expected deadline exceeded error, but got: %+v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Expected the process to be killed at the deadline, but took: %v", elapsed)
+	}
+}
+
+func TestOneShotInvoker_Invoke_runTooLongWithChildren(t *testing.T) {
+	invoker := NewOneShotInvoker(exec.Command("sh", "-c", "sleep 5 | cat"), OneShotInvokerConfig{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := invoker.Invoke(ctx, &Input{})
+
+	if err != context.DeadlineExceeded {
+		t.Errorf("Expected deadline exceeded error, but got: %+v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Expected the processes to be killed at the deadline, but took: %v", elapsed)
+	}
+}
+
+func TestOneShotInvoker_Invoke_missingTimeout(t *testing.T) {
+	invoker := NewOneShotInvoker(exec.Command("true"), OneShotInvokerConfig{})
+
+	_, err := invoker.Invoke(context.Background(), &Input{})
+
+	if err != ErrMissingTimeout {
+		t.Errorf("Expected missing timeout error, but got: %+v", err)
+	}
+}
+
+func TestNewOneShotInvokerFactory(t *testing.T) {
+	factory := NewOneShotInvokerFactory(exec.Command("cat"), OneShotInvokerConfig{})
+
+	config := InvokerPoolConfig{
+		MaxInvokerCount: 1,
+		InvokerFactory:  factory,
+		MaxWaitDuration: time.Second,
+		MaxRunnableTime: 10 * time.Second,
+	}
+	pool, err := NewInvokerPool(config)
+
+	if err != nil {
+		t.Fatalf("Creating invoker pool returned err: %+v", err)
+	}
+	defer pool.Close()
+
+	result, err := pool.Invoke(context.Background(), &Input{Data: []byte("echo")})
+
+	if err != nil {
+		t.Fatalf("Invoke() returned err: %+v", err)
+	}
+
+	if got := string(result.Data); got != "echo" {
+		t.Errorf("Did not read expected result: got %s; want echo", got)
+	}
+}
@@ -3,6 +3,8 @@ package fnrun
 import (
 	"context"
 	"errors"
+	"io"
+	"sync"
 	"time"
 )
 
@@ -13,68 +15,682 @@ import (
 // object, including maintaining a number of invoker instances available to
 // handle invocations; if an Invoker fails, it is discarded and replaced by a
 // new Invoker instance.
+//
+// Invokers may also be retired proactively after a number of invocations or
+// once they reach a maximum age. Retired and failed invokers are replaced in
+// the background so that callers are not blocked while a new Invoker starts; a
+// retired Invoker keeps handling invocations until its replacement is ready.
+//
+// The number of invokers may be changed while the pool is in use with
+// SetMaxInvokerCount.
 type InvokerPool struct {
-	config      InvokerPoolConfig
-	invokerChan chan Invoker
+	config InvokerPoolConfig
+
+	mu                  sync.Mutex
+	maxInvokerCount     int
+	members             map[*pooledInvoker]struct{}
+	pendingReplacements int
+	replacementErr      error
+	closed              bool
+
+	// invokerChan holds the idle invokers. Its capacity is at least the number
+	// of invokers owned by the pool, so sends never block. It is replaced by a
+	// larger channel when the pool grows, at which point resized is closed to
+	// wake callers waiting on the old channel.
+	invokerChan chan *pooledInvoker
+	resized     chan struct{}
+
+	// done is closed when the pool is closed to stop background work, which is
+	// tracked by workers.
+	done    chan struct{}
+	workers sync.WaitGroup
 }
 
+const (
+	// initialReplacementBackoff is how long the pool waits before retrying a
+	// failed attempt to replace an Invoker.
+	initialReplacementBackoff = 10 * time.Millisecond
+
+	// maxReplacementBackoff is the upper bound on the wait between attempts to
+	// replace an Invoker.
+	maxReplacementBackoff = 5 * time.Second
+
+	// minAgeSweepInterval and maxAgeSweepInterval bound how often the pool
+	// looks for invokers that have reached MaxInvokerAge.
+	minAgeSweepInterval = 10 * time.Millisecond
+	maxAgeSweepInterval = time.Second
+)
+
 // InvokerPoolConfig contains the configuration data for an InvokerPool.
 type InvokerPoolConfig struct {
 	MaxInvokerCount int
 	InvokerFactory  InvokerFactory
 	MaxWaitDuration time.Duration
 	MaxRunnableTime time.Duration
+
+	// MaxInvocationsPerInvoker is the number of invocations an Invoker may
+	// handle before it is retired and replaced. A value of zero means that
+	// invokers are never retired because of the number of invocations.
+	MaxInvocationsPerInvoker int
+
+	// MaxInvokerAge is the age after which an Invoker is retired and replaced.
+	// The pool checks the age of idle and busy invokers in the background, and
+	// an Invoker keeps handling invocations until its replacement is ready. A
+	// value of zero means that invokers are never retired because of their
+	// age.
+	MaxInvokerAge time.Duration
+
+	// MaxInvokerRSS is the resident set size, in bytes, above which an Invoker
+	// is retired and replaced. The resident set size is sampled between
+	// invocations for invokers that support it, such as those created by
+	// NewCmdInvoker. A value of zero disables memory-based recycling and the
+	// sampling it needs.
+	MaxInvokerRSS int64
+}
+
+// pooledInvoker tracks the bookkeeping the pool needs for each Invoker.
+//
+// The invocations, rss and recycling fields, as well as the fields that follow
+// them, are guarded by the mutex of the pool that owns the pooledInvoker.
+type pooledInvoker struct {
+	invoker     Invoker
+	createdAt   time.Time
+	invocations int
+	rss         int64
+
+	// recycling is set while a replacement is being created, and replacement
+	// holds it once it is ready to take the place of this Invoker.
+	recycling   bool
+	replacement *pooledInvoker
+
+	// recycleBackoff is the wait after the most recent failed attempt to
+	// create a replacement, and no attempt is made before nextRecycle.
+	recycleBackoff time.Duration
+	nextRecycle    time.Time
+}
+
+// rssSampler is implemented by invokers that can report the resident set size
+// of the process backing them.
+type rssSampler interface {
+	residentSetSize() (int64, error)
+}
+
+// PoolStats is a snapshot of the state of an InvokerPool.
+type PoolStats struct {
+	// Invokers contains the statistics for each Invoker currently owned by the
+	// pool, whether it is idle or handling an invocation.
+	Invokers []InvokerStats
+
+	// MaxInvokerCount is the number of invokers the pool is trying to
+	// maintain.
+	MaxInvokerCount int
+
+	// PendingReplacements is the number of invokers the pool is waiting to
+	// create, either to replace failed invokers or to grow the pool.
+	PendingReplacements int
+
+	// ReplacementErr is the error returned by the InvokerFactory on the most
+	// recent failed attempt to replace an Invoker. It is nil once a replacement
+	// succeeds.
+	ReplacementErr error
+}
+
+// InvokerStats contains the statistics for a single Invoker in a pool.
+type InvokerStats struct {
+	CreatedAt   time.Time
+	Invocations int
+
+	// RSS is the resident set size, in bytes, sampled after the most recent
+	// invocation. It is zero if MaxInvokerRSS is not set, if the Invoker does
+	// not support sampling, or if it has not yet been sampled.
+	RSS int64
 }
 
 // NewInvokerPool creats a new InvokerPool with the provided configuration.
+//
+// If the InvokerFactory fails to create one of the initial invokers, the
+// invokers already created are closed and the error is returned.
 func NewInvokerPool(config InvokerPoolConfig) (*InvokerPool, error) {
-	invokerChan := make(chan Invoker, config.MaxInvokerCount)
+	pool := &InvokerPool{
+		config:          config,
+		maxInvokerCount: config.MaxInvokerCount,
+		members:         make(map[*pooledInvoker]struct{}),
+		invokerChan:     make(chan *pooledInvoker, config.MaxInvokerCount),
+		resized:         make(chan struct{}),
+		done:            make(chan struct{}),
+	}
+
 	for i := 0; i < config.MaxInvokerCount; i++ {
 		invoker, err := config.InvokerFactory.NewInvoker()
 		if err != nil {
+			pool.Close()
 			return nil, err
 		}
-		invokerChan <- invoker
+		pool.invokerChan <- pool.track(invoker)
 	}
 
-	pool := &InvokerPool{
-		config:      config,
-		invokerChan: invokerChan,
+	if config.MaxInvokerAge > 0 {
+		pool.goBackground(pool.sweepAged)
 	}
 
 	return pool, nil
 }
 
+// track registers invoker as a member of the pool.
+func (pool *InvokerPool) track(invoker Invoker) *pooledInvoker {
+	pi := &pooledInvoker{
+		invoker:   invoker,
+		createdAt: time.Now(),
+	}
+
+	pool.mu.Lock()
+	pool.members[pi] = struct{}{}
+	pool.mu.Unlock()
+
+	return pi
+}
+
+// remove unregisters pi as a member of the pool without closing its Invoker.
+func (pool *InvokerPool) remove(pi *pooledInvoker) {
+	pool.mu.Lock()
+	pool.removeLocked(pi)
+	pool.mu.Unlock()
+}
+
+// removeLocked unregisters pi as a member of the pool without closing its
+// Invoker. A replacement that is ready for pi is no longer needed and is closed
+// in the background. The caller must hold pool.mu.
+func (pool *InvokerPool) removeLocked(pi *pooledInvoker) {
+	delete(pool.members, pi)
+	if pi.replacement != nil {
+		go closeInvoker(pi.replacement.invoker)
+		pi.replacement = nil
+	}
+}
+
+// swapLocked returns the replacement of pi if one is ready, in which case the
+// replacement takes the place of pi in the pool and the Invoker of pi is closed
+// in the background. Otherwise pi is returned. The caller must hold pool.mu.
+func (pool *InvokerPool) swapLocked(pi *pooledInvoker) *pooledInvoker {
+	replacement := pi.replacement
+	if replacement == nil {
+		return pi
+	}
+
+	delete(pool.members, pi)
+	pool.members[replacement] = struct{}{}
+	pi.replacement = nil
+	go closeInvoker(pi.invoker)
+
+	return replacement
+}
+
+// retire removes pi from the pool and closes its Invoker.
+func (pool *InvokerPool) retire(pi *pooledInvoker) {
+	pool.remove(pi)
+	closeInvoker(pi.invoker)
+}
+
+// excessLocked returns the number of invokers the pool owns or is creating
+// beyond its maximum invoker count. The result is negative if the pool has
+// fewer invokers than it should. The caller must hold pool.mu.
+func (pool *InvokerPool) excessLocked() int {
+	return len(pool.members) + pool.pendingReplacements - pool.maxInvokerCount
+}
+
+// Stats returns a snapshot of the state of the pool.
+func (pool *InvokerPool) Stats() PoolStats {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	stats := PoolStats{
+		Invokers:            make([]InvokerStats, 0, len(pool.members)),
+		MaxInvokerCount:     pool.maxInvokerCount,
+		PendingReplacements: pool.pendingReplacements,
+		ReplacementErr:      pool.replacementErr,
+	}
+	for pi := range pool.members {
+		stats.Invokers = append(stats.Invokers, InvokerStats{
+			CreatedAt:   pi.createdAt,
+			Invocations: pi.invocations,
+			RSS:         pi.rss,
+		})
+	}
+
+	return stats
+}
+
+// put returns pi to the set of idle invokers, or retires it if the pool has
+// been closed or has more invokers than its maximum invoker count. A retired
+// Invoker is closed in the background so that the caller returning it is not
+// delayed.
+//
+// The pool never owns more invokers than the capacity of invokerChan, so the
+// send does not block while the lock is held.
+func (pool *InvokerPool) put(pi *pooledInvoker) {
+	pool.mu.Lock()
+	pi = pool.swapLocked(pi)
+	if !pool.closed && pool.excessLocked() <= 0 {
+		pool.invokerChan <- pi
+		pool.mu.Unlock()
+		return
+	}
+	pool.removeLocked(pi)
+	pool.mu.Unlock()
+
+	go closeInvoker(pi.invoker)
+}
+
+// goBackground runs f in a goroutine tracked by the pool so that Close can wait
+// for it. It returns false without running f if the pool has been closed.
+func (pool *InvokerPool) goBackground(f func()) bool {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	if pool.closed {
+		return false
+	}
+
+	pool.workers.Add(1)
+	go func() {
+		defer pool.workers.Done()
+		f()
+	}()
+
+	return true
+}
+
+// Close shuts down the pool.
+//
+// Background replacement of invokers is stopped and idle invokers are closed.
+// Invokers that are handling an invocation are closed once the invocation
+// completes. Calls to Invoke after Close return ErrPoolClosed.
+func (pool *InvokerPool) Close() error {
+	pool.mu.Lock()
+	if pool.closed {
+		pool.mu.Unlock()
+		return nil
+	}
+	pool.closed = true
+	close(pool.done)
+	invokerChan := pool.invokerChan
+	pool.mu.Unlock()
+
+	pool.workers.Wait()
+
+	for {
+		select {
+		case pi := <-invokerChan:
+			pool.retire(pi)
+		default:
+			return nil
+		}
+	}
+}
+
 // Invoke attempts to use an Invoker in the pool to satisfy the invocation
 // request.
 //
 // If a worker Invoker is not available within the MaxWaitDuration of the pool
 // configuration, an ErrAvailabilityTimeout error is returned from this
 // function.
+//
+// If the invocation fails, the error from the Invoker is returned and the
+// Invoker is replaced in the background.
 func (pool *InvokerPool) Invoke(ctx context.Context, input *Input) (*Result, error) {
 	// TODO Keep track of how many invoker instances we have (that are in use or
 	// available; that haven't failed and been unreplaced). Once that number hits
 	// zero, we should return an appropriate error
-	select {
-	case invoker := <-pool.invokerChan:
-		childCtx, cancel := context.WithTimeout(ctx, pool.config.MaxRunnableTime)
-		defer cancel()
-		result, err := invoker.Invoke(childCtx, input)
-		if err != nil {
-			newInvoker, factoryErr := pool.config.InvokerFactory.NewInvoker()
-			if factoryErr != nil {
-				return nil, errors.New("could not create invoker")
+	pi, err := pool.acquire()
+	if err != nil {
+		return nil, err
+	}
+
+	childCtx, cancel := context.WithTimeout(ctx, pool.config.MaxRunnableTime)
+	defer cancel()
+	result, err := pi.invoker.Invoke(childCtx, input)
+	if err != nil {
+		pool.remove(pi)
+		go closeInvoker(pi.invoker)
+		pool.startReplacement()
+		return nil, err
+	}
+	pool.recordInvocation(pi)
+	if pool.shouldRecycle(pi) {
+		pool.startRecycle(pi)
+	}
+	pool.put(pi)
+	return result, err
+}
+
+// acquire waits up to MaxWaitDuration for an idle Invoker.
+func (pool *InvokerPool) acquire() (*pooledInvoker, error) {
+	timeout := time.NewTimer(pool.config.MaxWaitDuration)
+	defer timeout.Stop()
+
+	for {
+		pool.mu.Lock()
+		invokerChan, resized := pool.invokerChan, pool.resized
+		pool.mu.Unlock()
+
+		select {
+		case pi := <-invokerChan:
+			pool.mu.Lock()
+			pi = pool.swapLocked(pi)
+			pool.mu.Unlock()
+			return pi, nil
+		case <-resized:
+			// The pool has a new channel of idle invokers; wait on that instead.
+		case <-pool.done:
+			return nil, ErrPoolClosed
+		case <-timeout.C:
+			return nil, ErrAvailabilityTimeout
+		}
+	}
+}
+
+// SetMaxInvokerCount changes the number of invokers the pool maintains.
+//
+// When the count grows, new invokers are created in the background and become
+// available as they start. When the count shrinks, idle invokers are retired
+// immediately and invokers handling an invocation are retired once it
+// completes. Retired invokers are closed in the background.
+func (pool *InvokerPool) SetMaxInvokerCount(n int) error {
+	if n < 0 {
+		return errors.New("max invoker count must not be negative")
+	}
+
+	pool.mu.Lock()
+	if pool.closed {
+		pool.mu.Unlock()
+		return ErrPoolClosed
+	}
+
+	pool.maxInvokerCount = n
+	if n > cap(pool.invokerChan) {
+		pool.growLocked(n)
+	}
+
+	var retired []*pooledInvoker
+drain:
+	for pool.excessLocked() > 0 {
+		select {
+		case pi := <-pool.invokerChan:
+			pool.removeLocked(pi)
+			retired = append(retired, pi)
+		default:
+			break drain
+		}
+	}
+
+	missing := -pool.excessLocked()
+	pool.mu.Unlock()
+
+	for _, pi := range retired {
+		go closeInvoker(pi.invoker)
+	}
+
+	for i := 0; i < missing; i++ {
+		pool.startReplacement()
+	}
+
+	return nil
+}
+
+// growLocked replaces invokerChan with a channel of the given capacity, moving
+// any idle invokers to it. The caller must hold pool.mu.
+func (pool *InvokerPool) growLocked(capacity int) {
+	invokerChan := make(chan *pooledInvoker, capacity)
+
+move:
+	for {
+		select {
+		case pi := <-pool.invokerChan:
+			invokerChan <- pi
+		default:
+			break move
+		}
+	}
+
+	pool.invokerChan = invokerChan
+	close(pool.resized)
+	pool.resized = make(chan struct{})
+}
+
+// startReplacement begins creating an Invoker in the background, either to
+// replace a failed Invoker or to grow the pool.
+func (pool *InvokerPool) startReplacement() {
+	pool.mu.Lock()
+	pool.pendingReplacements++
+	pool.mu.Unlock()
+
+	if !pool.goBackground(pool.replace) {
+		pool.finishReplacement(nil)
+	}
+}
+
+// replace creates a new Invoker and adds it to the pool, retrying with an
+// exponential backoff while the factory fails. It gives up when the pool is
+// closed or when the pool has shrunk so that the Invoker is no longer needed.
+func (pool *InvokerPool) replace() {
+	backoff := initialReplacementBackoff
+	for {
+		pool.mu.Lock()
+		unneeded := pool.excessLocked() > 0
+		pool.mu.Unlock()
+
+		if unneeded {
+			pool.finishReplacement(nil)
+			return
+		}
+
+		invoker, err := pool.config.InvokerFactory.NewInvoker()
+		if err == nil {
+			pool.finishReplacement(nil)
+			pool.put(pool.track(invoker))
+			return
+		}
+
+		pool.mu.Lock()
+		pool.replacementErr = err
+		pool.mu.Unlock()
+
+		select {
+		case <-pool.done:
+			pool.finishReplacement(err)
+			return
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > maxReplacementBackoff {
+			backoff = maxReplacementBackoff
+		}
+	}
+}
+
+// finishReplacement records that a pending replacement is no longer pending,
+// with err being the last error returned by the factory, if any.
+func (pool *InvokerPool) finishReplacement(err error) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	pool.pendingReplacements--
+	pool.replacementErr = err
+}
+
+// recordInvocation updates the statistics of pi after a successful invocation,
+// including sampling its resident set size if MaxInvokerRSS is set and the
+// Invoker supports it.
+func (pool *InvokerPool) recordInvocation(pi *pooledInvoker) {
+	var rss int64
+	if sampler, ok := pi.invoker.(rssSampler); ok && pool.config.MaxInvokerRSS > 0 {
+		if sample, err := sampler.residentSetSize(); err == nil {
+			rss = sample
+		}
+	}
+
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	pi.invocations++
+	if rss > 0 {
+		pi.rss = rss
+	}
+}
+
+// shouldRecycle reports whether pi has reached one of the retirement limits in
+// the pool configuration.
+func (pool *InvokerPool) shouldRecycle(pi *pooledInvoker) bool {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	maxRSS := pool.config.MaxInvokerRSS
+	if maxRSS > 0 && pi.rss > maxRSS {
+		return true
+	}
+
+	maxInvocations := pool.config.MaxInvocationsPerInvoker
+	if maxInvocations > 0 && pi.invocations >= maxInvocations {
+		return true
+	}
+
+	return pool.agedLocked(pi)
+}
+
+// agedLocked reports whether pi has reached the MaxInvokerAge of the pool. The
+// caller must hold pool.mu.
+func (pool *InvokerPool) agedLocked(pi *pooledInvoker) bool {
+	maxAge := pool.config.MaxInvokerAge
+	return maxAge > 0 && time.Since(pi.createdAt) >= maxAge
+}
+
+// sweepAged periodically starts recycling the invokers that have reached
+// MaxInvokerAge, including idle invokers, until the pool is closed.
+func (pool *InvokerPool) sweepAged() {
+	interval := pool.config.MaxInvokerAge / 4
+	if interval < minAgeSweepInterval {
+		interval = minAgeSweepInterval
+	}
+	if interval > maxAgeSweepInterval {
+		interval = maxAgeSweepInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-pool.done:
+			return
+		case <-ticker.C:
+		}
+
+		var aged []*pooledInvoker
+		pool.mu.Lock()
+		for pi := range pool.members {
+			if pool.agedLocked(pi) {
+				aged = append(aged, pi)
 			}
-			pool.invokerChan <- newInvoker
-			return nil, err
 		}
-		pool.invokerChan <- invoker
-		return result, err
-	case <-time.After(pool.config.MaxWaitDuration):
-		return nil, ErrAvailabilityTimeout
+		pool.mu.Unlock()
+
+		for _, pi := range aged {
+			pool.startRecycle(pi)
+		}
+	}
+}
+
+// startRecycle begins creating a replacement for pi in the background unless
+// one is already being created or is ready, or a failed attempt is being
+// backed off from.
+func (pool *InvokerPool) startRecycle(pi *pooledInvoker) {
+	pool.mu.Lock()
+	if pi.recycling || pi.replacement != nil || time.Now().Before(pi.nextRecycle) {
+		pool.mu.Unlock()
+		return
+	}
+	pi.recycling = true
+	pool.mu.Unlock()
+
+	if !pool.goBackground(func() { pool.recycle(pi) }) {
+		pool.mu.Lock()
+		pi.recycling = false
+		pool.mu.Unlock()
+	}
+}
+
+// recycle creates a replacement for old with the factory. Until the
+// replacement is ready, old keeps handling invocations so that no capacity is
+// lost; once it is ready, it takes the place of old when old is next idle.
+//
+// If the factory fails, old is kept and will be considered for recycling again
+// after a backoff that grows as with the replacement of failed invokers. If the pool has shrunk or old has been removed from the pool, no
+// replacement is kept.
+func (pool *InvokerPool) recycle(old *pooledInvoker) {
+	pool.mu.Lock()
+	unneeded := pool.excessLocked() > 0
+	pool.mu.Unlock()
+
+	if unneeded {
+		pool.mu.Lock()
+		old.recycling = false
+		pool.mu.Unlock()
+		return
+	}
+
+	invoker, err := pool.config.InvokerFactory.NewInvoker()
+
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	old.recycling = false
+	if err != nil {
+		old.recycleBackoff *= 2
+		if old.recycleBackoff < initialReplacementBackoff {
+			old.recycleBackoff = initialReplacementBackoff
+		}
+		if old.recycleBackoff > maxReplacementBackoff {
+			old.recycleBackoff = maxReplacementBackoff
+		}
+		old.nextRecycle = time.Now().Add(old.recycleBackoff)
+		return
+	}
+
+	if _, member := pool.members[old]; !member || pool.closed {
+		go closeInvoker(invoker)
+		return
+	}
+
+	old.replacement = &pooledInvoker{invoker: invoker, createdAt: time.Now()}
+	pool.swapIdleLocked()
+}
+
+// swapIdleLocked puts ready replacements in place of the idle invokers they
+// replace. The caller must hold pool.mu, so the sends do not block.
+func (pool *InvokerPool) swapIdleLocked() {
+	for i, n := 0, len(pool.invokerChan); i < n; i++ {
+		select {
+		case pi := <-pool.invokerChan:
+			pool.invokerChan <- pool.swapLocked(pi)
+		default:
+			return
+		}
+	}
+}
+
+// closeInvoker releases the resources held by invoker if it supports being
+// closed.
+func closeInvoker(invoker Invoker) {
+	if closer, ok := invoker.(io.Closer); ok {
+		closer.Close()
 	}
 }
 
 // ErrAvailabilityTimeout is an error that indicates that an invoker did not
 // become available within the allow time period.
 var ErrAvailabilityTimeout = errors.New("could not get access to invoker before timeout")
+
+// ErrPoolClosed is an error that indicates that an invocation was attempted on
+// a pool that has been closed.
+var ErrPoolClosed = errors.New("invoker pool is closed")
@@ -3,6 +3,7 @@ package fnrun
 import (
 	"context"
 	"errors"
+	"sync"
 	"testing"
 	"time"
 )
@@ -71,10 +72,79 @@ func TestInvokerPool_Invoke_funcErr(t *testing.T) {
 		t.Errorf("Expected result to be nil, but got: %+v", result)
 	}
 
-	length := len(pool.invokerChan)
+	waitFor(t, func() bool { return len(pool.invokerChan) == config.MaxInvokerCount })
+}
+
+func TestInvokerPool_Invoke_replacementFactoryErr(t *testing.T) {
+	errFactory := errors.New("factory failure")
+	factory := &countingInvokerFactory{invokeErr: ErrFake}
+	config := InvokerPoolConfig{
+		MaxInvokerCount: 1,
+		InvokerFactory:  factory,
+		MaxWaitDuration: 5 * time.Millisecond,
+		MaxRunnableTime: time.Second,
+	}
+	pool, err := NewInvokerPool(config)
+
+	if err != nil {
+		t.Fatalf("Creating invoker pool returned err: %+v", err)
+	}
+	defer pool.Close()
+
+	factory.setErr(errFactory)
 
-	if length != config.MaxInvokerCount {
-		t.Errorf("Expected available invokers to be %d, but was %d", config.MaxInvokerCount, length)
+	_, err = pool.Invoke(context.Background(), &Input{})
+
+	if err != ErrFake {
+		t.Errorf("Expected the invocation error, but got: %+v", err)
+	}
+
+	waitFor(t, func() bool { return pool.Stats().ReplacementErr == errFactory })
+
+	if pending := pool.Stats().PendingReplacements; pending != 1 {
+		t.Errorf("Expected 1 pending replacement, but got %d", pending)
+	}
+
+	factory.setErr(nil)
+
+	waitFor(t, func() bool { return len(pool.invokerChan) == 1 })
+
+	stats := pool.Stats()
+	if stats.PendingReplacements != 0 || stats.ReplacementErr != nil {
+		t.Errorf("Expected replacement to complete, but stats are: %+v", stats)
+	}
+}
+
+func TestInvokerPool_Close(t *testing.T) {
+	factory := &countingInvokerFactory{}
+	config := InvokerPoolConfig{
+		MaxInvokerCount: 2,
+		InvokerFactory:  factory,
+		MaxWaitDuration: time.Second,
+		MaxRunnableTime: time.Second,
+	}
+	pool, err := NewInvokerPool(config)
+
+	if err != nil {
+		t.Fatalf("Creating invoker pool returned err: %+v", err)
+	}
+
+	err = pool.Close()
+
+	if err != nil {
+		t.Errorf("Close() returned err: %+v", err)
+	}
+
+	for _, invoker := range factory.created() {
+		if !invoker.isClosed() {
+			t.Errorf("Expected idle invoker to be closed")
+		}
+	}
+
+	_, err = pool.Invoke(context.Background(), &Input{})
+
+	if err != ErrPoolClosed {
+		t.Errorf("Expected pool closed error, but got: %+v", err)
 	}
 }
 
@@ -138,6 +208,508 @@ func TestInvokerPool_Invoke_success(t *testing.T) {
 	}
 }
 
+func TestInvokerPool_Invoke_recycleAfterInvocations(t *testing.T) {
+	factory := &countingInvokerFactory{}
+	config := InvokerPoolConfig{
+		MaxInvokerCount:          1,
+		InvokerFactory:           factory,
+		MaxWaitDuration:          time.Second,
+		MaxRunnableTime:          time.Second,
+		MaxInvocationsPerInvoker: 2,
+	}
+	pool, err := NewInvokerPool(config)
+
+	if err != nil {
+		t.Fatalf("Creating invoker pool returned err: %+v", err)
+	}
+
+	first := factory.created()[0]
+
+	for i := 0; i < 2; i++ {
+		_, err = pool.Invoke(context.Background(), &Input{})
+		if err != nil {
+			t.Fatalf("Invoke() unexpectedly returned err: %+v", err)
+		}
+	}
+
+	waitFor(t, func() bool { return first.isClosed() })
+
+	created := factory.created()
+	if len(created) != 2 {
+		t.Fatalf("Expected 2 invokers to be created, but got %d", len(created))
+	}
+
+	_, err = pool.Invoke(context.Background(), &Input{})
+	if err != nil {
+		t.Fatalf("Invoke() unexpectedly returned err: %+v", err)
+	}
+
+	if created[1].invocationCount() != 1 {
+		t.Errorf("Expected replacement invoker to handle the invocation")
+	}
+}
+
+func TestInvokerPool_Invoke_recycleAfterAge(t *testing.T) {
+	factory := &countingInvokerFactory{}
+	config := InvokerPoolConfig{
+		MaxInvokerCount: 1,
+		InvokerFactory:  factory,
+		MaxWaitDuration: time.Second,
+		MaxRunnableTime: time.Second,
+		MaxInvokerAge:   50 * time.Millisecond,
+	}
+	pool, err := NewInvokerPool(config)
+
+	if err != nil {
+		t.Fatalf("Creating invoker pool returned err: %+v", err)
+	}
+	defer pool.Close()
+
+	first := factory.created()[0]
+	waitFor(t, func() bool { return first.isClosed() })
+
+	_, err = pool.Invoke(context.Background(), &Input{})
+	if err != nil {
+		t.Fatalf("Invoke() unexpectedly returned err: %+v", err)
+	}
+
+	if count := first.invocationCount(); count != 0 {
+		t.Errorf("Expected the idle invoker to be replaced before it was used, but it handled %d invocations", count)
+	}
+}
+
+func TestInvokerPool_Invoke_recycleKeepsServing(t *testing.T) {
+	factory := &countingInvokerFactory{}
+	config := InvokerPoolConfig{
+		MaxInvokerCount:          1,
+		InvokerFactory:           factory,
+		MaxWaitDuration:          100 * time.Millisecond,
+		MaxRunnableTime:          time.Second,
+		MaxInvocationsPerInvoker: 1,
+	}
+	pool, err := NewInvokerPool(config)
+
+	if err != nil {
+		t.Fatalf("Creating invoker pool returned err: %+v", err)
+	}
+	defer pool.Close()
+
+	factory.setDelay(500 * time.Millisecond)
+
+	for i := 0; i < 3; i++ {
+		_, err = pool.Invoke(context.Background(), &Input{})
+		if err != nil {
+			t.Fatalf("Invoke() returned err while a replacement was starting: %+v", err)
+		}
+	}
+
+	first := factory.created()[0]
+	if count := first.invocationCount(); count != 3 {
+		t.Errorf("Expected the original invoker to keep serving, but it handled %d invocations", count)
+	}
+
+	waitFor(t, func() bool { return first.isClosed() })
+}
+
+func TestInvokerPool_Invoke_recycleFactoryErr(t *testing.T) {
+	factory := &countingInvokerFactory{}
+	config := InvokerPoolConfig{
+		MaxInvokerCount:          1,
+		InvokerFactory:           factory,
+		MaxWaitDuration:          time.Second,
+		MaxRunnableTime:          time.Second,
+		MaxInvocationsPerInvoker: 1,
+	}
+	pool, err := NewInvokerPool(config)
+
+	if err != nil {
+		t.Fatalf("Creating invoker pool returned err: %+v", err)
+	}
+
+	factory.setErr(ErrFake)
+
+	for i := 0; i < 3; i++ {
+		_, err = pool.Invoke(context.Background(), &Input{})
+		if err != nil {
+			t.Fatalf("Invoke() unexpectedly returned err: %+v", err)
+		}
+	}
+
+	first := factory.created()[0]
+	if first.isClosed() {
+		t.Errorf("Expected invoker to be kept when no replacement could be created")
+	}
+
+	if count := first.invocationCount(); count != 3 {
+		t.Errorf("Expected original invoker to handle 3 invocations, but handled %d", count)
+	}
+}
+
+func TestInvokerPool_Invoke_recycleFactoryErrBacksOff(t *testing.T) {
+	factory := &countingInvokerFactory{}
+	config := InvokerPoolConfig{
+		MaxInvokerCount:          1,
+		InvokerFactory:           factory,
+		MaxWaitDuration:          time.Second,
+		MaxRunnableTime:          time.Second,
+		MaxInvocationsPerInvoker: 1,
+	}
+	pool, err := NewInvokerPool(config)
+
+	if err != nil {
+		t.Fatalf("Creating invoker pool returned err: %+v", err)
+	}
+	defer pool.Close()
+
+	factory.setErr(ErrFake)
+
+	// Without a backoff, every invocation would retry the factory.
+	deadline := time.Now().Add(50 * time.Millisecond)
+	for time.Now().Before(deadline) {
+		if _, err := pool.Invoke(context.Background(), &Input{}); err != nil {
+			t.Fatalf("Invoke() unexpectedly returned err: %+v", err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if attempts := factory.callCount() - 1; attempts < 1 || attempts > 4 {
+		t.Errorf("Expected a few attempts to create a replacement, but got: %d", attempts)
+	}
+}
+
+func TestInvokerPool_Invoke_recycleAboveRSS(t *testing.T) {
+	config := InvokerPoolConfig{
+		MaxInvokerCount: 1,
+		InvokerFactory:  &rssInvokerFactory{rss: 2048},
+		MaxWaitDuration: time.Second,
+		MaxRunnableTime: time.Second,
+		MaxInvokerRSS:   1024,
+	}
+	pool, err := NewInvokerPool(config)
+
+	if err != nil {
+		t.Fatalf("Creating invoker pool returned err: %+v", err)
+	}
+
+	original := <-pool.invokerChan
+	pool.invokerChan <- original
+
+	_, err = pool.Invoke(context.Background(), &Input{})
+	if err != nil {
+		t.Fatalf("Invoke() unexpectedly returned err: %+v", err)
+	}
+
+	waitFor(t, func() bool {
+		stats := pool.Stats()
+		return len(stats.Invokers) == 1 && stats.Invokers[0].Invocations == 0
+	})
+	replacement := <-pool.invokerChan
+
+	if replacement == original {
+		t.Errorf("Expected invoker above the RSS threshold to be replaced")
+	}
+}
+
+func TestInvokerPool_Stats(t *testing.T) {
+	config := InvokerPoolConfig{
+		MaxInvokerCount: 2,
+		InvokerFactory:  &rssInvokerFactory{rss: 4096},
+		MaxWaitDuration: time.Second,
+		MaxRunnableTime: time.Second,
+		MaxInvokerRSS:   8192,
+	}
+	pool, err := NewInvokerPool(config)
+
+	if err != nil {
+		t.Fatalf("Creating invoker pool returned err: %+v", err)
+	}
+
+	_, err = pool.Invoke(context.Background(), &Input{})
+	if err != nil {
+		t.Fatalf("Invoke() unexpectedly returned err: %+v", err)
+	}
+
+	stats := pool.Stats()
+
+	if len(stats.Invokers) != 2 {
+		t.Fatalf("Expected stats for 2 invokers, but got %d", len(stats.Invokers))
+	}
+
+	var invocations int
+	var sampled int
+	for _, s := range stats.Invokers {
+		invocations += s.Invocations
+		if s.RSS == 4096 {
+			sampled++
+		}
+	}
+
+	if invocations != 1 {
+		t.Errorf("Expected 1 invocation in stats, but got %d", invocations)
+	}
+
+	if sampled != 1 {
+		t.Errorf("Expected 1 invoker with a sampled RSS, but got %d", sampled)
+	}
+}
+
+func TestInvokerPool_Stats_withoutMaxInvokerRSS(t *testing.T) {
+	config := InvokerPoolConfig{
+		MaxInvokerCount: 1,
+		InvokerFactory:  &rssInvokerFactory{rss: 4096},
+		MaxWaitDuration: time.Second,
+		MaxRunnableTime: time.Second,
+	}
+	pool, err := NewInvokerPool(config)
+
+	if err != nil {
+		t.Fatalf("Creating invoker pool returned err: %+v", err)
+	}
+	defer pool.Close()
+
+	_, err = pool.Invoke(context.Background(), &Input{})
+	if err != nil {
+		t.Fatalf("Invoke() unexpectedly returned err: %+v", err)
+	}
+
+	stats := pool.Stats()
+	if len(stats.Invokers) != 1 || stats.Invokers[0].RSS != 0 {
+		t.Errorf("Expected the RSS not to be sampled, but got: %+v", stats.Invokers)
+	}
+}
+
+func TestInvokerPool_SetMaxInvokerCount_grow(t *testing.T) {
+	factory := &countingInvokerFactory{}
+	config := InvokerPoolConfig{
+		MaxInvokerCount: 1,
+		InvokerFactory:  factory,
+		MaxWaitDuration: time.Second,
+		MaxRunnableTime: time.Second,
+	}
+	pool, err := NewInvokerPool(config)
+
+	if err != nil {
+		t.Fatalf("Creating invoker pool returned err: %+v", err)
+	}
+	defer pool.Close()
+
+	err = pool.SetMaxInvokerCount(3)
+
+	if err != nil {
+		t.Fatalf("SetMaxInvokerCount() returned err: %+v", err)
+	}
+
+	waitFor(t, func() bool { return len(pool.Stats().Invokers) == 3 })
+
+	if max := pool.Stats().MaxInvokerCount; max != 3 {
+		t.Errorf("Expected max invoker count to be 3, but was %d", max)
+	}
+}
+
+func TestInvokerPool_SetMaxInvokerCount_wakesWaiters(t *testing.T) {
+	config := InvokerPoolConfig{
+		MaxInvokerCount: 0,
+		InvokerFactory:  &simpleInvokerFactory{},
+		MaxWaitDuration: 5 * time.Second,
+		MaxRunnableTime: time.Second,
+	}
+	pool, err := NewInvokerPool(config)
+
+	if err != nil {
+		t.Fatalf("Creating invoker pool returned err: %+v", err)
+	}
+	defer pool.Close()
+
+	errChan := make(chan error, 1)
+	go func() {
+		_, err := pool.Invoke(context.Background(), &Input{})
+		errChan <- err
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+
+	err = pool.SetMaxInvokerCount(1)
+	if err != nil {
+		t.Fatalf("SetMaxInvokerCount() returned err: %+v", err)
+	}
+
+	select {
+	case err = <-errChan:
+		if err != nil {
+			t.Errorf("Invoke() unexpectedly returned err: %+v", err)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Invoke() was not served after the pool grew")
+	}
+}
+
+func TestInvokerPool_SetMaxInvokerCount_shrink(t *testing.T) {
+	factory := &countingInvokerFactory{}
+	config := InvokerPoolConfig{
+		MaxInvokerCount: 3,
+		InvokerFactory:  factory,
+		MaxWaitDuration: time.Second,
+		MaxRunnableTime: time.Second,
+	}
+	pool, err := NewInvokerPool(config)
+
+	if err != nil {
+		t.Fatalf("Creating invoker pool returned err: %+v", err)
+	}
+	defer pool.Close()
+
+	inUse, err := pool.acquire()
+	if err != nil {
+		t.Fatalf("acquire() returned err: %+v", err)
+	}
+
+	err = pool.SetMaxInvokerCount(0)
+
+	if err != nil {
+		t.Fatalf("SetMaxInvokerCount() returned err: %+v", err)
+	}
+
+	if count := len(pool.Stats().Invokers); count != 1 {
+		t.Errorf("Expected only the in-use invoker to remain, but %d remain", count)
+	}
+
+	pool.put(inUse)
+
+	if count := len(pool.Stats().Invokers); count != 0 {
+		t.Errorf("Expected all invokers to be retired, but %d remain", count)
+	}
+
+	waitFor(t, func() bool {
+		for _, invoker := range factory.created() {
+			if !invoker.isClosed() {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+func TestInvokerPool_SetMaxInvokerCount_shrinkDoesNotDelayInvoke(t *testing.T) {
+	factory := &blockingInvokerFactory{
+		started:    make(chan struct{}, 1),
+		release:    make(chan struct{}),
+		closeDelay: time.Second,
+	}
+	config := InvokerPoolConfig{
+		MaxInvokerCount: 1,
+		InvokerFactory:  factory,
+		MaxWaitDuration: time.Second,
+		MaxRunnableTime: 5 * time.Second,
+	}
+	pool, err := NewInvokerPool(config)
+
+	if err != nil {
+		t.Fatalf("Creating invoker pool returned err: %+v", err)
+	}
+	defer pool.Close()
+
+	returned := make(chan time.Time, 1)
+	go func() {
+		pool.Invoke(context.Background(), &Input{})
+		returned <- time.Now()
+	}()
+	<-factory.started
+
+	err = pool.SetMaxInvokerCount(0)
+
+	if err != nil {
+		t.Fatalf("SetMaxInvokerCount() returned err: %+v", err)
+	}
+
+	released := time.Now()
+	close(factory.release)
+
+	if elapsed := (<-returned).Sub(released); elapsed > factory.closeDelay/2 {
+		t.Errorf("Expected Invoke() to return before the retired invoker was closed, but it took %v", elapsed)
+	}
+}
+
+func TestInvokerPool_SetMaxInvokerCount_negative(t *testing.T) {
+	config := InvokerPoolConfig{
+		MaxInvokerCount: 1,
+		InvokerFactory:  &simpleInvokerFactory{},
+		MaxWaitDuration: time.Second,
+		MaxRunnableTime: time.Second,
+	}
+	pool, err := NewInvokerPool(config)
+
+	if err != nil {
+		t.Fatalf("Creating invoker pool returned err: %+v", err)
+	}
+	defer pool.Close()
+
+	err = pool.SetMaxInvokerCount(-1)
+
+	if err == nil {
+		t.Errorf("SetMaxInvokerCount() did not return error")
+	}
+}
+
+func TestNewInvokerPool_factoryErrClosesInvokers(t *testing.T) {
+	factory := &limitedCountingInvokerFactory{limit: 2}
+
+	config := InvokerPoolConfig{
+		MaxInvokerCount: 3,
+		InvokerFactory:  factory,
+		MaxWaitDuration: time.Second,
+		MaxRunnableTime: time.Second,
+	}
+	_, err := NewInvokerPool(config)
+
+	if err != ErrFake {
+		t.Errorf("Expected fake error, but got: %+v", err)
+	}
+
+	for _, invoker := range factory.created() {
+		if !invoker.isClosed() {
+			t.Errorf("Expected invokers created before the error to be closed")
+		}
+	}
+}
+
+// waitFor polls cond until it returns true, failing the test if that does not
+// happen within a second.
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("condition not met before deadline")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// invokeData invokes invoker with an empty Input, failing the test if the
+// invocation returns an error, and returns the result data.
+func invokeData(ctx context.Context, t *testing.T, invoker Invoker) string {
+	t.Helper()
+
+	result, err := invoker.Invoke(ctx, &Input{})
+	if err != nil {
+		t.Fatalf("Invoke() returned err: %+v", err)
+	}
+	return string(result.Data)
+}
+
+// newTestPool creates a pool with config, failing the test if that returns an
+// error. Closing the pool is left to the caller.
+func newTestPool(t *testing.T, config InvokerPoolConfig) *InvokerPool {
+	t.Helper()
+
+	pool, err := NewInvokerPool(config)
+	if err != nil {
+		t.Fatalf("NewInvokerPool() returned err: %+v", err)
+	}
+	return pool
+}
+
 // -----------------------------------------------------------------------------
 // Sample invokers and factories
 
@@ -152,6 +724,34 @@ func (factory *invokerFactoryThatCannotCreateInvoker) NewInvoker() (Invoker, err
 	return nil, ErrFake
 }
 
+// ---------------------------------
+// Pools whose invokers return a label or fail
+
+// labelPoolConfig returns a pool config whose invokers return label as their
+// result data.
+func labelPoolConfig(label string, count int) InvokerPoolConfig {
+	return InvokerPoolConfig{
+		MaxInvokerCount: count,
+		InvokerFactory: NewFuncInvokerFactory(func(context.Context, *Input) (*Result, error) {
+			return &Result{Data: []byte(label)}, nil
+		}),
+		MaxWaitDuration: time.Second,
+		MaxRunnableTime: time.Second,
+	}
+}
+
+// failingPoolConfig returns a pool config whose invokers fail with ErrFake.
+func failingPoolConfig(count int) InvokerPoolConfig {
+	return InvokerPoolConfig{
+		MaxInvokerCount: count,
+		InvokerFactory: NewFuncInvokerFactory(func(context.Context, *Input) (*Result, error) {
+			return nil, ErrFake
+		}),
+		MaxWaitDuration: time.Second,
+		MaxRunnableTime: time.Second,
+	}
+}
+
 // ---------------------------------
 // Simple invoker
 
@@ -181,3 +781,162 @@ type errInvoker struct{}
 func (ef *errInvoker) Invoke(context.Context, *Input) (*Result, error) {
 	return nil, ErrFake
 }
+
+// ---------------------------------
+// Factory that keeps track of the invokers it creates
+
+type countingInvokerFactory struct {
+	mu        sync.Mutex
+	invokers  []*countingInvoker
+	err       error
+	invokeErr error
+	delay     time.Duration
+	calls     int
+}
+
+func (factory *countingInvokerFactory) NewInvoker() (Invoker, error) {
+	factory.mu.Lock()
+	delay := factory.delay
+	factory.mu.Unlock()
+	time.Sleep(delay)
+
+	factory.mu.Lock()
+	defer factory.mu.Unlock()
+
+	factory.calls++
+	if factory.err != nil {
+		return nil, factory.err
+	}
+
+	invoker := &countingInvoker{err: factory.invokeErr}
+	factory.invokers = append(factory.invokers, invoker)
+	return invoker, nil
+}
+
+func (factory *countingInvokerFactory) setErr(err error) {
+	factory.mu.Lock()
+	defer factory.mu.Unlock()
+	factory.err = err
+}
+
+func (factory *countingInvokerFactory) setDelay(delay time.Duration) {
+	factory.mu.Lock()
+	defer factory.mu.Unlock()
+	factory.delay = delay
+}
+
+func (factory *countingInvokerFactory) callCount() int {
+	factory.mu.Lock()
+	defer factory.mu.Unlock()
+	return factory.calls
+}
+
+func (factory *countingInvokerFactory) created() []*countingInvoker {
+	factory.mu.Lock()
+	defer factory.mu.Unlock()
+	return append([]*countingInvoker(nil), factory.invokers...)
+}
+
+type countingInvoker struct {
+	mu          sync.Mutex
+	invocations int
+	closed      bool
+	err         error
+}
+
+func (ci *countingInvoker) Invoke(context.Context, *Input) (*Result, error) {
+	ci.mu.Lock()
+	defer ci.mu.Unlock()
+	ci.invocations++
+	if ci.err != nil {
+		return nil, ci.err
+	}
+	return &Result{}, nil
+}
+
+func (ci *countingInvoker) Close() error {
+	ci.mu.Lock()
+	defer ci.mu.Unlock()
+	ci.closed = true
+	return nil
+}
+
+func (ci *countingInvoker) invocationCount() int {
+	ci.mu.Lock()
+	defer ci.mu.Unlock()
+	return ci.invocations
+}
+
+func (ci *countingInvoker) isClosed() bool {
+	ci.mu.Lock()
+	defer ci.mu.Unlock()
+	return ci.closed
+}
+
+// ---------------------------------
+// Invoker that reports a fixed resident set size
+
+type rssInvokerFactory struct {
+	rss int64
+}
+
+func (factory *rssInvokerFactory) NewInvoker() (Invoker, error) {
+	return &rssInvoker{rss: factory.rss}, nil
+}
+
+type rssInvoker struct {
+	rss int64
+}
+
+func (ri *rssInvoker) Invoke(context.Context, *Input) (*Result, error) {
+	return &Result{}, nil
+}
+
+func (ri *rssInvoker) residentSetSize() (int64, error) {
+	return ri.rss, nil
+}
+
+// ---------------------------------
+// Invoker that blocks until released and is slow to close
+
+type blockingInvokerFactory struct {
+	started    chan struct{}
+	release    chan struct{}
+	closeDelay time.Duration
+}
+
+func (factory *blockingInvokerFactory) NewInvoker() (Invoker, error) {
+	return &blockingInvoker{factory: factory}, nil
+}
+
+type blockingInvoker struct {
+	factory *blockingInvokerFactory
+}
+
+func (bi *blockingInvoker) Invoke(context.Context, *Input) (*Result, error) {
+	bi.factory.started <- struct{}{}
+	<-bi.factory.release
+	return &Result{}, nil
+}
+
+func (bi *blockingInvoker) Close() error {
+	time.Sleep(bi.factory.closeDelay)
+	return nil
+}
+
+// ---------------------------------
+// Factory that fails after creating a number of invokers
+
+// limitedCountingInvokerFactory creates limit invokers and then fails with
+// ErrFake.
+type limitedCountingInvokerFactory struct {
+	countingInvokerFactory
+	limit int
+}
+
+func (factory *limitedCountingInvokerFactory) NewInvoker() (Invoker, error) {
+	if len(factory.created()) >= factory.limit {
+		return nil, ErrFake
+	}
+	return factory.countingInvokerFactory.NewInvoker()
+}
@@ -0,0 +1,28 @@
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build aix darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package fnrun
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup configures cmd to start in a new process group so that
+// killProcessGroup also reaches the processes it starts. The SysProcAttr of
+// cmd is copied because clones of a command share it.
+func setProcessGroup(cmd *exec.Cmd) {
+	attr := &syscall.SysProcAttr{}
+	if cmd.SysProcAttr != nil {
+		*attr = *cmd.SysProcAttr
+	}
+	attr.Setpgid = true
+	attr.Pgid = 0
+	cmd.SysProcAttr = attr
+}
+
+// killProcessGroup kills the process group started by cmd, which must have
+// been configured with setProcessGroup and not yet waited for.
+func killProcessGroup(cmd *exec.Cmd) error {
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
@@ -0,0 +1,15 @@
+//go:build !aix && !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris
+// +build !aix,!darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package fnrun
+
+import "os/exec"
+
+// setProcessGroup does nothing on systems without Unix process groups.
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// killProcessGroup kills only the process started by cmd on systems without
+// Unix process groups.
+func killProcessGroup(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
@@ -0,0 +1,287 @@
+package fnrun
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ErrFunctionNotFound is an error that indicates that a Router has no function
+// registered under the requested name and version.
+var ErrFunctionNotFound = errors.New("function not found")
+
+// ErrProcessLimit is an error that indicates that an Invoker could not be
+// created because the process limit of a Router has been reached.
+var ErrProcessLimit = errors.New("process limit reached")
+
+// RouterConfig contains the configuration data for a Router.
+type RouterConfig struct {
+	// MaxProcessCount is the maximum number of invokers that may exist across
+	// all of the pools of the Router. A value of zero means that there is no
+	// limit.
+	MaxProcessCount int
+}
+
+// FunctionID identifies a function registered with a Router.
+type FunctionID struct {
+	Name    string
+	Version string
+}
+
+// String returns the id in the form name@version.
+func (id FunctionID) String() string {
+	return id.Name + "@" + id.Version
+}
+
+// Router hosts many named functions, each version of which is served by its
+// own InvokerPool.
+//
+// Functions may be registered and unregistered while the Router is in use.
+// Invoke routes an invocation by name, either to a specific version given as
+// name@version or, for a plain name, to the most recently registered version
+// that is still registered.
+//
+// If the config has a MaxProcessCount, the invokers of all the pools share it
+// as a global cap: an InvokerFactory call that would exceed it fails with
+// ErrProcessLimit, and a slot is released when an Invoker is closed. Pools
+// replace invokers in the background, so a pool that is below its size because
+// of the cap grows again once slots become available. Recycling an Invoker
+// creates its replacement before closing it, so pools that recycle invokers
+// need spare slots to do so.
+type Router struct {
+	slots chan struct{}
+
+	mu       sync.RWMutex
+	pools    map[FunctionID]*InvokerPool
+	versions map[string][]string
+	closed   bool
+}
+
+// NewRouter creates a Router with the provided configuration.
+func NewRouter(config RouterConfig) *Router {
+	router := &Router{
+		pools:    make(map[FunctionID]*InvokerPool),
+		versions: make(map[string][]string),
+	}
+
+	if config.MaxProcessCount > 0 {
+		router.slots = make(chan struct{}, config.MaxProcessCount)
+	}
+
+	return router
+}
+
+// Register creates a pool for the version of the function identified by name
+// and version using config. It returns an error if the name or version is
+// empty or contains "@", if the version is already registered, or if the pool
+// cannot be created, which includes not having enough process slots for its
+// initial invokers.
+func (router *Router) Register(name, version string, config InvokerPoolConfig) error {
+	if name == "" || version == "" || strings.Contains(name, "@") || strings.Contains(version, "@") {
+		return errors.New("invalid function name or version: " + name + "@" + version)
+	}
+	id := FunctionID{Name: name, Version: version}
+
+	if _, ok := router.Pool(name, version); ok {
+		return errors.New("function already registered: " + id.String())
+	}
+
+	if router.slots != nil {
+		config.InvokerFactory = &limitedInvokerFactory{factory: config.InvokerFactory, slots: router.slots}
+	}
+
+	// The pool is created without holding the lock because starting its
+	// invokers may take a while.
+	pool, err := NewInvokerPool(config)
+	if err != nil {
+		return err
+	}
+
+	router.mu.Lock()
+	defer router.mu.Unlock()
+
+	if router.closed {
+		pool.Close()
+		return ErrPoolClosed
+	}
+	if _, ok := router.pools[id]; ok {
+		pool.Close()
+		return errors.New("function already registered: " + id.String())
+	}
+
+	router.pools[id] = pool
+	router.versions[name] = append(router.versions[name], version)
+
+	return nil
+}
+
+// Unregister removes the version of the function identified by name and
+// version and closes its pool. Invocations already in progress are allowed to
+// complete.
+func (router *Router) Unregister(name, version string) error {
+	id := FunctionID{Name: name, Version: version}
+
+	router.mu.Lock()
+	pool, ok := router.pools[id]
+	if ok {
+		delete(router.pools, id)
+		router.versions[name] = removeString(router.versions[name], version)
+		if len(router.versions[name]) == 0 {
+			delete(router.versions, name)
+		}
+	}
+	router.mu.Unlock()
+
+	if !ok {
+		return ErrFunctionNotFound
+	}
+
+	return pool.Close()
+}
+
+// Pool returns the pool serving the version of the function identified by
+// name and version.
+func (router *Router) Pool(name, version string) (*InvokerPool, bool) {
+	router.mu.RLock()
+	defer router.mu.RUnlock()
+
+	pool, ok := router.pools[FunctionID{Name: name, Version: version}]
+	return pool, ok
+}
+
+// Functions returns the ids of the registered functions, sorted by name and
+// then by version.
+func (router *Router) Functions() []FunctionID {
+	router.mu.RLock()
+	defer router.mu.RUnlock()
+
+	ids := make([]FunctionID, 0, len(router.pools))
+	for id := range router.pools {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if ids[i].Name != ids[j].Name {
+			return ids[i].Name < ids[j].Name
+		}
+		return ids[i].Version < ids[j].Version
+	})
+
+	return ids
+}
+
+// ProcessCount returns the number of invokers that currently hold a process
+// slot. It is always zero if the Router has no MaxProcessCount.
+func (router *Router) ProcessCount() int {
+	return len(router.slots)
+}
+
+// Invoke routes an invocation to the function identified by name, which is
+// either a plain name or has the form name@version. It returns
+// ErrFunctionNotFound if no matching function is registered; otherwise it
+// returns the result of invoking the pool of the function.
+func (router *Router) Invoke(ctx context.Context, name string, input *Input) (*Result, error) {
+	pool, ok := router.route(name)
+	if !ok {
+		return nil, ErrFunctionNotFound
+	}
+
+	return pool.Invoke(ctx, input)
+}
+
+func (router *Router) route(name string) (*InvokerPool, bool) {
+	router.mu.RLock()
+	defer router.mu.RUnlock()
+
+	id := FunctionID{Name: name}
+	if i := strings.Index(name, "@"); i >= 0 {
+		id = FunctionID{Name: name[:i], Version: name[i+1:]}
+	} else {
+		versions := router.versions[name]
+		if len(versions) == 0 {
+			return nil, false
+		}
+		id.Version = versions[len(versions)-1]
+	}
+
+	pool, ok := router.pools[id]
+	return pool, ok
+}
+
+// Close unregisters every function and closes its pool. Calls to Register
+// after Close return ErrPoolClosed.
+func (router *Router) Close() error {
+	router.mu.Lock()
+	router.closed = true
+	pools := router.pools
+	router.pools = make(map[FunctionID]*InvokerPool)
+	router.versions = make(map[string][]string)
+	router.mu.Unlock()
+
+	for _, pool := range pools {
+		pool.Close()
+	}
+
+	return nil
+}
+
+func removeString(values []string, value string) []string {
+	result := values[:0:0]
+	for _, v := range values {
+		if v != value {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+// limitedInvokerFactory creates invokers only while a slot is available in
+// slots. Each Invoker holds its slot until it is closed.
+type limitedInvokerFactory struct {
+	factory InvokerFactory
+	slots   chan struct{}
+}
+
+func (factory *limitedInvokerFactory) NewInvoker() (Invoker, error) {
+	select {
+	case factory.slots <- struct{}{}:
+	default:
+		return nil, ErrProcessLimit
+	}
+
+	invoker, err := factory.factory.NewInvoker()
+	if err != nil {
+		<-factory.slots
+		return nil, err
+	}
+
+	return &limitedInvoker{invoker: invoker, slots: factory.slots}, nil
+}
+
+type limitedInvoker struct {
+	invoker   Invoker
+	slots     chan struct{}
+	closeOnce sync.Once
+}
+
+func (li *limitedInvoker) Invoke(ctx context.Context, input *Input) (*Result, error) {
+	return li.invoker.Invoke(ctx, input)
+}
+
+// Close closes the underlying Invoker and releases its slot.
+func (li *limitedInvoker) Close() error {
+	li.closeOnce.Do(func() {
+		closeInvoker(li.invoker)
+		<-li.slots
+	})
+	return nil
+}
+
+func (li *limitedInvoker) residentSetSize() (int64, error) {
+	sampler, ok := li.invoker.(rssSampler)
+	if !ok {
+		return 0, errors.New("invoker does not support resident set size sampling")
+	}
+	return sampler.residentSetSize()
+}
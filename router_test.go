@@ -0,0 +1,176 @@
+package fnrun
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// routedInvoker returns an Invoker that invokes the function name of router.
+func routedInvoker(router *Router, name string) Invoker {
+	return FuncInvoker(func(ctx context.Context, input *Input) (*Result, error) {
+		return router.Invoke(ctx, name, input)
+	})
+}
+
+func TestRouter_Invoke(t *testing.T) {
+	router := NewRouter(RouterConfig{})
+	defer router.Close()
+
+	for _, version := range []string{"v1", "v2"} {
+		if err := router.Register("greeter", version, labelPoolConfig("greeter@"+version, 1)); err != nil {
+			t.Fatalf("Register() returned err: %+v", err)
+		}
+	}
+	if err := router.Register("echo", "v1", labelPoolConfig("echo@v1", 1)); err != nil {
+		t.Fatalf("Register() returned err: %+v", err)
+	}
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"greeter", "greeter@v2"},
+		{"greeter@v1", "greeter@v1"},
+		{"greeter@v2", "greeter@v2"},
+		{"echo", "echo@v1"},
+	}
+
+	for _, tt := range tests {
+		if got := invokeData(context.Background(), t, routedInvoker(router, tt.name)); got != tt.want {
+			t.Errorf("Invoke(%s) was routed to %s; want %s", tt.name, got, tt.want)
+		}
+	}
+
+	for _, name := range []string{"missing", "greeter@v3", "echo@"} {
+		_, err := router.Invoke(context.Background(), name, &Input{})
+		if err != ErrFunctionNotFound {
+			t.Errorf("Expected function not found error for %s, but got: %+v", name, err)
+		}
+	}
+
+	want := []FunctionID{{"echo", "v1"}, {"greeter", "v1"}, {"greeter", "v2"}}
+	got := router.Functions()
+	if len(got) != len(want) {
+		t.Fatalf("Expected functions %v, but got: %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Expected functions %v, but got: %v", want, got)
+		}
+	}
+}
+
+func TestRouter_Unregister(t *testing.T) {
+	router := NewRouter(RouterConfig{})
+	defer router.Close()
+
+	router.Register("greeter", "v1", labelPoolConfig("v1", 1))
+	router.Register("greeter", "v2", labelPoolConfig("v2", 1))
+	pool, _ := router.Pool("greeter", "v2")
+
+	if err := router.Unregister("greeter", "v2"); err != nil {
+		t.Fatalf("Unregister() returned err: %+v", err)
+	}
+
+	if got := invokeData(context.Background(), t, routedInvoker(router, "greeter")); got != "v1" {
+		t.Errorf("Expected to fall back to v1, but was routed to: %s", got)
+	}
+
+	if _, err := pool.Invoke(context.Background(), &Input{}); err != ErrPoolClosed {
+		t.Errorf("Expected the unregistered pool to be closed, but got: %+v", err)
+	}
+
+	router.Unregister("greeter", "v1")
+
+	if _, err := router.Invoke(context.Background(), "greeter", &Input{}); err != ErrFunctionNotFound {
+		t.Errorf("Expected function not found error, but got: %+v", err)
+	}
+
+	if err := router.Unregister("greeter", "v1"); err != ErrFunctionNotFound {
+		t.Errorf("Expected function not found error, but got: %+v", err)
+	}
+}
+
+func TestRouter_Register_invalid(t *testing.T) {
+	router := NewRouter(RouterConfig{})
+	defer router.Close()
+
+	router.Register("greeter", "v1", labelPoolConfig("v1", 1))
+
+	tests := []struct {
+		name    string
+		fn      string
+		version string
+	}{
+		{"duplicate", "greeter", "v1"},
+		{"empty name", "", "v1"},
+		{"empty version", "greeter", ""},
+		{"@ in name", "greeter@v2", "v2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := router.Register(tt.fn, tt.version, labelPoolConfig("x", 1)); err == nil {
+				t.Errorf("Register() did not return error")
+			}
+		})
+	}
+}
+
+func TestRouter_maxProcessCount(t *testing.T) {
+	router := NewRouter(RouterConfig{MaxProcessCount: 3})
+	defer router.Close()
+
+	if err := router.Register("a", "v1", labelPoolConfig("a", 2)); err != nil {
+		t.Fatalf("Register() returned err: %+v", err)
+	}
+
+	factory := &countingInvokerFactory{}
+	config := InvokerPoolConfig{
+		MaxInvokerCount: 2,
+		InvokerFactory:  factory,
+		MaxWaitDuration: time.Second,
+		MaxRunnableTime: time.Second,
+	}
+
+	err := router.Register("b", "v1", config)
+
+	if err != ErrProcessLimit {
+		t.Errorf("Expected process limit error, but got: %+v", err)
+	}
+
+	if created := factory.created(); len(created) != 1 || !created[0].isClosed() {
+		t.Errorf("Expected the invoker created within the limit to be closed")
+	}
+
+	if count := router.ProcessCount(); count != 2 {
+		t.Errorf("Expected 2 processes, but got: %d", count)
+	}
+
+	router.Unregister("a", "v1")
+
+	if count := router.ProcessCount(); count != 0 {
+		t.Errorf("Expected unregistering to release processes, but got: %d", count)
+	}
+
+	if err := router.Register("b", "v1", config); err != nil {
+		t.Errorf("Register() returned err: %+v", err)
+	}
+}
+
+func TestRouter_Close(t *testing.T) {
+	router := NewRouter(RouterConfig{})
+	router.Register("greeter", "v1", labelPoolConfig("v1", 1))
+	pool, _ := router.Pool("greeter", "v1")
+
+	router.Close()
+
+	if _, err := pool.Invoke(context.Background(), &Input{}); err != ErrPoolClosed {
+		t.Errorf("Expected the pool to be closed, but got: %+v", err)
+	}
+
+	if err := router.Register("greeter", "v2", labelPoolConfig("v2", 1)); err != ErrPoolClosed {
+		t.Errorf("Expected pool closed error, but got: %+v", err)
+	}
+}
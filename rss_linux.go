@@ -0,0 +1,52 @@
+package fnrun
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// readRSS returns the resident set size, in bytes, of the process identified by
+// pid as reported by the VmRSS line of /proc/<pid>/status.
+func readRSS(pid int) (int64, error) {
+	f, err := os.Open("/proc/" + strconv.Itoa(pid) + "/status")
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	return parseRSS(f)
+}
+
+// parseRSS extracts the VmRSS value from the contents of a /proc/<pid>/status
+// file.
+func parseRSS(r io.Reader) (int64, error) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "VmRSS:") {
+			continue
+		}
+
+		// The line has the form "VmRSS:     1234 kB".
+		fields := strings.Fields(line)
+		if len(fields) != 3 || fields[2] != "kB" {
+			return 0, errors.New("unexpected VmRSS format: " + line)
+		}
+
+		kb, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		return kb * 1024, nil
+	}
+
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+
+	return 0, errors.New("VmRSS not found in process status")
+}
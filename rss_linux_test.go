@@ -0,0 +1,45 @@
+package fnrun
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestReadRSS(t *testing.T) {
+	rss, err := readRSS(os.Getpid())
+
+	if err != nil {
+		t.Fatalf("readRSS() returned err: %+v", err)
+	}
+
+	if rss <= 0 {
+		t.Errorf("Expected a positive resident set size, but got %d", rss)
+	}
+}
+
+func TestParseRSS(t *testing.T) {
+	t.Run("with a VmRSS line", func(t *testing.T) {
+		status := "Name:\tcat\nVmPeak:\t    9000 kB\nVmRSS:\t    1234 kB\nThreads:\t1\n"
+
+		rss, err := parseRSS(strings.NewReader(status))
+
+		if err != nil {
+			t.Fatalf("parseRSS() returned err: %+v", err)
+		}
+
+		if rss != 1234*1024 {
+			t.Errorf("parseRSS(): got %d; want %d", rss, 1234*1024)
+		}
+	})
+
+	t.Run("without a VmRSS line", func(t *testing.T) {
+		status := "Name:\tkthreadd\nState:\tS (sleeping)\n"
+
+		_, err := parseRSS(strings.NewReader(status))
+
+		if err == nil {
+			t.Errorf("parseRSS() did not return error")
+		}
+	})
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+// +build !linux
+
+package fnrun
+
+import "errors"
+
+// readRSS is only supported on Linux, where the resident set size can be read
+// from /proc.
+func readRSS(pid int) (int64, error) {
+	return 0, errors.New("resident set size sampling is not supported on this platform")
+}
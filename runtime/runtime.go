@@ -0,0 +1,148 @@
+// Package runtime implements the function side of the fnrun protocol so that
+// functions written in Go only need to provide a Handler.
+//
+// A function program calls Start from main:
+//
+//	func main() {
+//		runtime.Start(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+//			env, _ := fnrun.Env(ctx)
+//			return &fnrun.Result{Data: []byte(env["GREETING"] + ", " + string(input.Data))}, nil
+//		})
+//	}
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+
+	tspb "github.com/golang/protobuf/ptypes"
+	"github.com/tessellator/fnrun"
+	"github.com/tessellator/fnrun/fnrun/protobufs"
+	"github.com/tessellator/protoio"
+)
+
+// ErrorStatus is the Result status reported when a Handler returns an error or
+// panics.
+const ErrorStatus = http.StatusInternalServerError
+
+// Handler handles a single invocation.
+//
+// The context carries the deadline of the invocation and the environment
+// variables sent by the runner, which are available through fnrun.Env.
+type Handler func(context.Context, *fnrun.Input) (*fnrun.Result, error)
+
+// Start serves invocations with handler until the runner closes the
+// connection, and then returns.
+//
+// Invocations are read from stdin and results are written to stdout, unless
+// the FNRUN_SOCKET_FD environment variable names an inherited socket, in which
+// case the socket is used for both. If the connection fails, the error is
+// written to stderr and the process exits with status 1.
+func Start(handler Handler) {
+	var r io.Reader = os.Stdin
+	var w io.Writer = os.Stdout
+
+	if value := os.Getenv(fnrun.SocketFDEnvVar); value != "" {
+		fd, err := strconv.Atoi(value)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid %s: %s\n", fnrun.SocketFDEnvVar, value)
+			os.Exit(1)
+		}
+		conn := os.NewFile(uintptr(fd), "fnrun")
+		r, w = conn, conn
+	}
+
+	err := Serve(r, w, handler)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// Serve reads invocations from r, calls handler for each of them, and writes
+// the results to w. It returns nil when r reaches EOF between invocations.
+//
+// If handler returns an error, the Result has ErrorStatus and the error
+// message as its data. A panic in handler is treated as an error, and the
+// stack trace of the panic is written to stderr.
+func Serve(r io.Reader, w io.Writer, handler Handler) error {
+	invoker := fnrun.FuncInvoker(handler)
+
+	for {
+		event := protobufs.Event{}
+		err := protoio.Read(r, &event)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		execCtx := protobufs.ExecutionContext{}
+		err = protoio.Read(r, &execCtx)
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel, err := contextFor(&execCtx)
+		if err != nil {
+			return err
+		}
+
+		result, err := invoker.Invoke(ctx, &fnrun.Input{Data: event.GetData()})
+		cancel()
+		if err != nil {
+			if panicErr, ok := err.(*fnrun.PanicError); ok {
+				fmt.Fprintf(os.Stderr, "%s\n%s", panicErr, panicErr.Stack)
+			}
+			result = &fnrun.Result{Status: ErrorStatus, Data: []byte(err.Error())}
+		}
+		if result == nil {
+			result = &fnrun.Result{}
+		}
+
+		_, err = protoio.Write(w, resultToProto(result))
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// contextFor creates the context for an invocation from its ExecutionContext.
+func contextFor(execCtx *protobufs.ExecutionContext) (context.Context, context.CancelFunc, error) {
+	env := make(map[string]string)
+	for _, envVar := range execCtx.GetEnvVars() {
+		env[envVar.GetName()] = envVar.GetValue()
+	}
+	ctx := fnrun.WithEnv(context.Background(), env)
+
+	if execCtx.GetStopTime() == nil {
+		ctx, cancel := context.WithCancel(ctx)
+		return ctx, cancel, nil
+	}
+
+	stopTime, err := tspb.Timestamp(execCtx.GetStopTime())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ctx, cancel := context.WithDeadline(ctx, stopTime)
+	return ctx, cancel, nil
+}
+
+func resultToProto(result *fnrun.Result) *protobufs.Result {
+	envVars := []*protobufs.EnvironmentVariable{}
+	for k, v := range result.Env {
+		envVars = append(envVars, &protobufs.EnvironmentVariable{Name: k, Value: v})
+	}
+
+	return &protobufs.Result{
+		Status:  int32(result.Status),
+		Data:    result.Data,
+		EnvVars: envVars,
+	}
+}
@@ -0,0 +1,196 @@
+package runtime
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/tessellator/fnrun"
+)
+
+// invocations encodes inputs as they are sent by a runner, using ctx for the
+// execution context of each of them.
+func invocations(t *testing.T, ctx context.Context, inputs ...string) *bytes.Buffer {
+	buf := &bytes.Buffer{}
+	for _, data := range inputs {
+		input := fnrun.Input{Data: []byte(data)}
+		if _, err := input.WriteTo(buf); err != nil {
+			t.Fatalf("Writing input returned err: %+v", err)
+		}
+		if _, err := fnrun.WriteTo(ctx, buf); err != nil {
+			t.Fatalf("Writing execution context returned err: %+v", err)
+		}
+	}
+	return buf
+}
+
+func readResults(t *testing.T, buf *bytes.Buffer) []*fnrun.Result {
+	var results []*fnrun.Result
+	for buf.Len() > 0 {
+		result := &fnrun.Result{}
+		if err := fnrun.ReadFrom(buf, result); err != nil {
+			t.Fatalf("ReadFrom() returned err: %+v", err)
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+func TestServe(t *testing.T) {
+	ctx := fnrun.WithEnv(context.Background(), map[string]string{"GREETING": "Hello"})
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	deadline, _ := ctx.Deadline()
+
+	in := invocations(t, ctx, "world", "again")
+	out := &bytes.Buffer{}
+
+	err := Serve(in, out, func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		env, _ := fnrun.Env(ctx)
+		got, _ := ctx.Deadline()
+		if !got.Equal(deadline) {
+			t.Errorf("Expected deadline %v, but got: %v", deadline, got)
+		}
+		return &fnrun.Result{
+			Status: 201,
+			Data:   []byte(env["GREETING"] + ", " + string(input.Data) + "!"),
+			Env:    map[string]string{"SEEN": "true"},
+		}, nil
+	})
+
+	if err != nil {
+		t.Fatalf("Serve() returned err: %+v", err)
+	}
+
+	results := readResults(t, out)
+	if len(results) != 2 {
+		t.Fatalf("Expected 2 results, but got: %d", len(results))
+	}
+
+	want := "Hello, again!"
+	if got := string(results[1].Data); got != want {
+		t.Errorf("Did not read expected result: got %s; want %s", got, want)
+	}
+
+	if results[0].Status != 201 || results[0].Env["SEEN"] != "true" {
+		t.Errorf("Expected status and env to be returned, but got: %+v", results[0])
+	}
+}
+
+func TestServe_errors(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	in := invocations(t, ctx, "error", "panic", "nil", "ok")
+	out := &bytes.Buffer{}
+
+	err := Serve(in, out, func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		switch string(input.Data) {
+		case "error":
+			return nil, errors.New("boom")
+		case "panic":
+			panic("oh no")
+		case "nil":
+			return nil, nil
+		}
+		return &fnrun.Result{Data: []byte("ok")}, nil
+	})
+
+	if err != nil {
+		t.Fatalf("Serve() returned err: %+v", err)
+	}
+
+	results := readResults(t, out)
+	if len(results) != 4 {
+		t.Fatalf("Expected 4 results, but got: %d", len(results))
+	}
+
+	if results[0].Status != ErrorStatus || string(results[0].Data) != "boom" {
+		t.Errorf("Expected an error result, but got: %+v", results[0])
+	}
+
+	if results[1].Status != ErrorStatus || string(results[1].Data) != "function panicked: oh no" {
+		t.Errorf("Expected a panic result, but got: %+v", results[1])
+	}
+
+	if results[2].Status != 0 || len(results[2].Data) != 0 {
+		t.Errorf("Expected an empty result, but got: %+v", results[2])
+	}
+
+	if string(results[3].Data) != "ok" {
+		t.Errorf("Expected serving to continue after errors, but got: %+v", results[3])
+	}
+}
+
+func TestServe_truncated(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	in := invocations(t, ctx, "world")
+	in.Truncate(in.Len() - 1)
+
+	err := Serve(in, &bytes.Buffer{}, func(context.Context, *fnrun.Input) (*fnrun.Result, error) {
+		return &fnrun.Result{}, nil
+	})
+
+	if err == nil {
+		t.Errorf("Expected an error for a truncated invocation")
+	}
+}
+
+func TestStart(t *testing.T) {
+	tests := []struct {
+		name   string
+		config fnrun.CmdInvokerConfig
+	}{
+		{"stdio", fnrun.CmdInvokerConfig{Transport: fnrun.StdioTransport}},
+		{"socket", fnrun.CmdInvokerConfig{Transport: fnrun.SocketTransport}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := exec.Command(os.Args[0], "-test.run=Test_EchoSubprocess")
+			cmd.Env = append(os.Environ(), "GO_RUNNING_SUBPROCESS=1")
+			invoker, err := fnrun.NewCmdInvokerWithConfig(cmd, tt.config)
+			if err != nil {
+				t.Fatalf("NewCmdInvokerWithConfig() returned err: %+v", err)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+
+			result, err := invoker.Invoke(ctx, &fnrun.Input{Data: []byte("echo")})
+
+			if err != nil {
+				t.Fatalf("Invoke() returned err: %+v", err)
+			}
+
+			if got := string(result.Data); got != "echo" {
+				t.Errorf("Did not read expected result: got %s; want echo", got)
+			}
+
+			invoker.(io.Closer).Close()
+
+			if !cmd.ProcessState.Success() {
+				t.Errorf("Expected the function to exit cleanly, but got: %v", cmd.ProcessState)
+			}
+		})
+	}
+}
+
+// ---
+
+func Test_EchoSubprocess(t *testing.T) {
+	if os.Getenv("GO_RUNNING_SUBPROCESS") != "1" {
+		return
+	}
+
+	Start(func(ctx context.Context, input *fnrun.Input) (*fnrun.Result, error) {
+		return &fnrun.Result{Data: input.Data}, nil
+	})
+}
@@ -0,0 +1,301 @@
+package fnrun
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/rand"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ShadowConfig contains the configuration data for a ShadowInvoker.
+type ShadowConfig struct {
+	// SampleRate is the fraction of invocations, between 0 and 1, that are
+	// mirrored to the shadow.
+	SampleRate float64
+
+	// MaxConcurrentShadows is the maximum number of shadow invocations in
+	// progress at once. Samples taken while the limit is reached are dropped. A
+	// value of zero means that there is no limit.
+	MaxConcurrentShadows int
+
+	// ShadowTimeout limits the duration of each shadow invocation. A value of
+	// zero means that only the shadow Invoker limits it.
+	ShadowTimeout time.Duration
+
+	// Record is called with each mismatch between the primary and the shadow.
+	// It is called from the goroutines of shadow invocations and must be safe
+	// for concurrent use.
+	Record func(ShadowDiff)
+}
+
+// ShadowOutcome is the outcome of one side of a mirrored invocation.
+type ShadowOutcome struct {
+	Status int               `json:"status"`
+	Data   []byte            `json:"data,omitempty"`
+	Env    map[string]string `json:"env,omitempty"`
+	Error  string            `json:"error,omitempty"`
+}
+
+// ShadowDiff describes how the result of a shadow invocation differs from the
+// result of the primary for the same Input.
+//
+// An invocation that fails is compared as a zero Result, so a failure on only
+// one side is reported as differences in Status and Data. Invocations that
+// fail on both sides are not reported.
+type ShadowDiff struct {
+	Time    time.Time     `json:"time"`
+	Input   []byte        `json:"input"`
+	Primary ShadowOutcome `json:"primary"`
+	Shadow  ShadowOutcome `json:"shadow"`
+
+	StatusDiffers bool `json:"status_differs"`
+	DataDiffers   bool `json:"data_differs"`
+
+	// EnvKeys contains the sorted names of the env entries that are missing
+	// from one side or have different values.
+	EnvKeys []string `json:"env_keys,omitempty"`
+}
+
+// ShadowStats contains the counts of mirrored invocations of a ShadowInvoker.
+type ShadowStats struct {
+	// Mirrored is the number of invocations sent to the shadow.
+	Mirrored int64
+
+	// Dropped is the number of samples that were not sent to the shadow
+	// because MaxConcurrentShadows was reached.
+	Dropped int64
+
+	// Matched and Differed are the numbers of completed shadow invocations
+	// whose results matched or differed from those of the primary.
+	Matched  int64
+	Differed int64
+}
+
+// ShadowInvoker is an Invoker that mirrors a sample of its invocations to a
+// shadow Invoker, such as a pool running a candidate version of a function.
+//
+// Callers always receive the result of the primary Invoker. Shadow
+// invocations run in the background with a copy of the Input and the env of
+// the original context, but are not canceled with it. Their results are
+// discarded after being compared with the primary result, and mismatches are
+// passed to the Record function of the config.
+//
+// The ShadowInvoker does not own the primary or the shadow; closing them is
+// left to the caller.
+type ShadowInvoker struct {
+	primary Invoker
+	shadow  Invoker
+	config  ShadowConfig
+	slots   chan struct{}
+
+	mu      sync.RWMutex
+	closed  bool
+	pending sync.WaitGroup
+
+	mirrored int64
+	dropped  int64
+	matched  int64
+	differed int64
+}
+
+// NewShadowInvoker creates a ShadowInvoker that returns the results of
+// primary and mirrors invocations to shadow as described by config.
+func NewShadowInvoker(primary, shadow Invoker, config ShadowConfig) (*ShadowInvoker, error) {
+	if config.SampleRate < 0 || config.SampleRate > 1 {
+		return nil, errors.New("sample rate must be between 0 and 1")
+	}
+	if config.MaxConcurrentShadows < 0 {
+		return nil, errors.New("max concurrent shadows must not be negative")
+	}
+
+	s := &ShadowInvoker{
+		primary: primary,
+		shadow:  shadow,
+		config:  config,
+	}
+	if config.MaxConcurrentShadows > 0 {
+		s.slots = make(chan struct{}, config.MaxConcurrentShadows)
+	}
+	return s, nil
+}
+
+// Invoke satisfies the invocation request with the primary Invoker and, if the
+// invocation is sampled, mirrors it to the shadow.
+func (s *ShadowInvoker) Invoke(ctx context.Context, input *Input) (*Result, error) {
+	result, err := s.primary.Invoke(ctx, input)
+
+	if s.config.SampleRate > 0 && rand.Float64() < s.config.SampleRate {
+		s.mirror(ctx, input, result, err)
+	}
+	return result, err
+}
+
+func (s *ShadowInvoker) mirror(ctx context.Context, input *Input, result *Result, err error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return
+	}
+
+	if s.slots != nil {
+		select {
+		case s.slots <- struct{}{}:
+		default:
+			atomic.AddInt64(&s.dropped, 1)
+			return
+		}
+	}
+	atomic.AddInt64(&s.mirrored, 1)
+
+	// The caller may reuse the input and result once Invoke returns.
+	shadowInput := &Input{Data: append([]byte(nil), input.Data...)}
+	primary := newShadowOutcome(result, err)
+	var shadowCtx context.Context = detachedContext{ctx}
+
+	s.pending.Add(1)
+	go func() {
+		defer s.pending.Done()
+		if s.slots != nil {
+			defer func() { <-s.slots }()
+		}
+
+		if s.config.ShadowTimeout > 0 {
+			var cancel context.CancelFunc
+			shadowCtx, cancel = context.WithTimeout(shadowCtx, s.config.ShadowTimeout)
+			defer cancel()
+		}
+		shadowResult, shadowErr := s.shadow.Invoke(shadowCtx, shadowInput)
+
+		diff, differs := compareShadow(primary, newShadowOutcome(shadowResult, shadowErr))
+		if !differs {
+			atomic.AddInt64(&s.matched, 1)
+			return
+		}
+		atomic.AddInt64(&s.differed, 1)
+
+		if s.config.Record != nil {
+			diff.Time = time.Now()
+			diff.Input = shadowInput.Data
+			s.config.Record(diff)
+		}
+	}()
+}
+
+// detachedContext carries the values of a context, such as its env, without
+// its deadline or cancellation.
+type detachedContext struct {
+	context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
+
+func newShadowOutcome(result *Result, err error) ShadowOutcome {
+	if err != nil {
+		return ShadowOutcome{Error: err.Error()}
+	}
+	if result == nil {
+		return ShadowOutcome{}
+	}
+
+	outcome := ShadowOutcome{
+		Status: result.Status,
+		Data:   append([]byte(nil), result.Data...),
+	}
+	if len(result.Env) > 0 {
+		outcome.Env = make(map[string]string, len(result.Env))
+		for k, v := range result.Env {
+			outcome.Env[k] = v
+		}
+	}
+	return outcome
+}
+
+// compareShadow returns the differences between the primary and shadow
+// outcomes and whether there are any.
+func compareShadow(primary, shadow ShadowOutcome) (ShadowDiff, bool) {
+	diff := ShadowDiff{Primary: primary, Shadow: shadow}
+	if primary.Error != "" && shadow.Error != "" {
+		return diff, false
+	}
+
+	diff.StatusDiffers = primary.Status != shadow.Status
+	diff.DataDiffers = !bytes.Equal(primary.Data, shadow.Data)
+	for k, v := range primary.Env {
+		if sv, ok := shadow.Env[k]; !ok || sv != v {
+			diff.EnvKeys = append(diff.EnvKeys, k)
+		}
+	}
+	for k := range shadow.Env {
+		if _, ok := primary.Env[k]; !ok {
+			diff.EnvKeys = append(diff.EnvKeys, k)
+		}
+	}
+	sort.Strings(diff.EnvKeys)
+
+	differs := diff.StatusDiffers || diff.DataDiffers || len(diff.EnvKeys) > 0 ||
+		(primary.Error == "") != (shadow.Error == "")
+	return diff, differs
+}
+
+// Stats returns the counts of mirrored invocations.
+func (s *ShadowInvoker) Stats() ShadowStats {
+	return ShadowStats{
+		Mirrored: atomic.LoadInt64(&s.mirrored),
+		Dropped:  atomic.LoadInt64(&s.dropped),
+		Matched:  atomic.LoadInt64(&s.matched),
+		Differed: atomic.LoadInt64(&s.differed),
+	}
+}
+
+// Close stops mirroring invocations and waits for the shadow invocations in
+// progress to complete. Invocations after Close are still satisfied by the
+// primary Invoker.
+func (s *ShadowInvoker) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+
+	s.pending.Wait()
+	return nil
+}
+
+// ShadowDiffWriter writes ShadowDiffs to a writer as newline-delimited JSON
+// for offline review. Its Record method can be used as the Record function of
+// a ShadowConfig.
+type ShadowDiffWriter struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+	err error
+}
+
+// NewShadowDiffWriter creates a ShadowDiffWriter that writes to w.
+func NewShadowDiffWriter(w io.Writer) *ShadowDiffWriter {
+	return &ShadowDiffWriter{enc: json.NewEncoder(w)}
+}
+
+// Record writes diff as a line of JSON. After a write fails, later diffs are
+// discarded and the error is reported by Err.
+func (w *ShadowDiffWriter) Record(diff ShadowDiff) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.err != nil {
+		return
+	}
+	w.err = w.enc.Encode(diff)
+}
+
+// Err returns the first error encountered while writing diffs.
+func (w *ShadowDiffWriter) Err() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.err
+}
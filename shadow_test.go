@@ -0,0 +1,209 @@
+package fnrun
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func resultInvoker(result *Result, err error) Invoker {
+	return FuncInvoker(func(context.Context, *Input) (*Result, error) {
+		return result, err
+	})
+}
+
+// diffCollector collects the diffs passed to its record method.
+type diffCollector struct {
+	mu    sync.Mutex
+	diffs []ShadowDiff
+}
+
+func (c *diffCollector) record(diff ShadowDiff) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.diffs = append(c.diffs, diff)
+}
+
+func TestShadowInvoker_Invoke_diff(t *testing.T) {
+	primary := resultInvoker(&Result{Status: 200, Data: []byte("v1"), Env: map[string]string{"A": "1", "B": "2"}}, nil)
+	shadow := resultInvoker(&Result{Status: 201, Data: []byte("v2"), Env: map[string]string{"A": "1", "B": "3", "C": "4"}}, nil)
+
+	collector := &diffCollector{}
+	s, err := NewShadowInvoker(primary, shadow, ShadowConfig{SampleRate: 1, Record: collector.record})
+	if err != nil {
+		t.Fatalf("NewShadowInvoker() returned err: %+v", err)
+	}
+
+	result, err := s.Invoke(context.Background(), &Input{Data: []byte("input")})
+	if err != nil {
+		t.Fatalf("Invoke() returned err: %+v", err)
+	}
+	if string(result.Data) != "v1" {
+		t.Errorf("Expected the primary result, but got: %+v", result)
+	}
+	s.Close()
+
+	if len(collector.diffs) != 1 {
+		t.Fatalf("Expected one diff, but got: %+v", collector.diffs)
+	}
+	diff := collector.diffs[0]
+	if string(diff.Input) != "input" || !diff.StatusDiffers || !diff.DataDiffers {
+		t.Errorf("Expected input, status and data in the diff, but got: %+v", diff)
+	}
+	if want := []string{"B", "C"}; !reflect.DeepEqual(diff.EnvKeys, want) {
+		t.Errorf("Expected env keys %v, but got: %v", want, diff.EnvKeys)
+	}
+
+	want := ShadowStats{Mirrored: 1, Differed: 1}
+	if stats := s.Stats(); stats != want {
+		t.Errorf("Expected stats %+v, but got: %+v", want, stats)
+	}
+}
+
+func TestShadowInvoker_Invoke_match(t *testing.T) {
+	result := &Result{Status: 200, Data: []byte("same")}
+	collector := &diffCollector{}
+	s, err := NewShadowInvoker(resultInvoker(result, nil), resultInvoker(result, nil), ShadowConfig{SampleRate: 1, Record: collector.record})
+	if err != nil {
+		t.Fatalf("NewShadowInvoker() returned err: %+v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		s.Invoke(context.Background(), &Input{})
+	}
+	s.Close()
+
+	if len(collector.diffs) != 0 {
+		t.Errorf("Expected no diffs, but got: %+v", collector.diffs)
+	}
+	want := ShadowStats{Mirrored: 3, Matched: 3}
+	if stats := s.Stats(); stats != want {
+		t.Errorf("Expected stats %+v, but got: %+v", want, stats)
+	}
+}
+
+func TestShadowInvoker_Invoke_shadowError(t *testing.T) {
+	collector := &diffCollector{}
+	s, err := NewShadowInvoker(resultInvoker(&Result{Status: 200}, nil), resultInvoker(nil, ErrFake), ShadowConfig{SampleRate: 1, Record: collector.record})
+	if err != nil {
+		t.Fatalf("NewShadowInvoker() returned err: %+v", err)
+	}
+
+	if _, err := s.Invoke(context.Background(), &Input{}); err != nil {
+		t.Fatalf("Expected the shadow error to be hidden from the caller, but got: %+v", err)
+	}
+	s.Close()
+
+	if len(collector.diffs) != 1 || collector.diffs[0].Shadow.Error != ErrFake.Error() {
+		t.Errorf("Expected a diff with the shadow error, but got: %+v", collector.diffs)
+	}
+}
+
+func TestShadowInvoker_Invoke_sampleRate(t *testing.T) {
+	var calls int
+	shadow := FuncInvoker(func(context.Context, *Input) (*Result, error) {
+		calls++
+		return &Result{}, nil
+	})
+
+	s, err := NewShadowInvoker(resultInvoker(&Result{}, nil), shadow, ShadowConfig{SampleRate: 0})
+	if err != nil {
+		t.Fatalf("NewShadowInvoker() returned err: %+v", err)
+	}
+	for i := 0; i < 10; i++ {
+		s.Invoke(context.Background(), &Input{})
+	}
+	s.Close()
+
+	if calls != 0 {
+		t.Errorf("Expected no shadow invocations, but got: %d", calls)
+	}
+}
+
+func TestShadowInvoker_Invoke_maxConcurrentShadows(t *testing.T) {
+	release := make(chan struct{})
+	shadow := FuncInvoker(func(context.Context, *Input) (*Result, error) {
+		<-release
+		return &Result{}, nil
+	})
+
+	s, err := NewShadowInvoker(resultInvoker(&Result{}, nil), shadow, ShadowConfig{SampleRate: 1, MaxConcurrentShadows: 1})
+	if err != nil {
+		t.Fatalf("NewShadowInvoker() returned err: %+v", err)
+	}
+	for i := 0; i < 3; i++ {
+		s.Invoke(context.Background(), &Input{})
+	}
+	close(release)
+	s.Close()
+
+	want := ShadowStats{Mirrored: 1, Dropped: 2, Matched: 1}
+	if stats := s.Stats(); stats != want {
+		t.Errorf("Expected stats %+v, but got: %+v", want, stats)
+	}
+}
+
+func TestShadowInvoker_Invoke_context(t *testing.T) {
+	shadowErr := make(chan error, 1)
+	shadow := FuncInvoker(func(ctx context.Context, input *Input) (*Result, error) {
+		env, _ := Env(ctx)
+		shadowErr <- ctx.Err()
+		return &Result{Env: env}, nil
+	})
+	primary := FuncInvoker(func(ctx context.Context, input *Input) (*Result, error) {
+		env, _ := Env(ctx)
+		return &Result{Env: env}, nil
+	})
+
+	s, err := NewShadowInvoker(primary, shadow, ShadowConfig{SampleRate: 1})
+	if err != nil {
+		t.Fatalf("NewShadowInvoker() returned err: %+v", err)
+	}
+
+	ctx, cancel := context.WithCancel(WithEnv(context.Background(), map[string]string{"KEY": "value"}))
+	s.Invoke(ctx, &Input{})
+	cancel()
+	s.Close()
+
+	if err := <-shadowErr; err != nil {
+		t.Errorf("Expected the shadow context not to be canceled with the caller, but got: %+v", err)
+	}
+	if stats := s.Stats(); stats.Matched != 1 {
+		t.Errorf("Expected the shadow to receive the env of the caller, but got: %+v", stats)
+	}
+}
+
+func TestNewShadowInvoker_invalid(t *testing.T) {
+	invoker := resultInvoker(&Result{}, nil)
+
+	for _, config := range []ShadowConfig{{SampleRate: -0.1}, {SampleRate: 1.1}, {MaxConcurrentShadows: -1}} {
+		if _, err := NewShadowInvoker(invoker, invoker, config); err == nil {
+			t.Errorf("Expected an error for config %+v", config)
+		}
+	}
+}
+
+func TestShadowDiffWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewShadowDiffWriter(&buf)
+
+	w.Record(ShadowDiff{Input: []byte("a"), DataDiffers: true})
+	w.Record(ShadowDiff{Input: []byte("b"), StatusDiffers: true})
+	if err := w.Err(); err != nil {
+		t.Fatalf("Err() returned: %+v", err)
+	}
+
+	dec := json.NewDecoder(&buf)
+	for _, want := range []string{"a", "b"} {
+		var diff ShadowDiff
+		if err := dec.Decode(&diff); err != nil {
+			t.Fatalf("Expected a JSON diff, but got: %+v", err)
+		}
+		if string(diff.Input) != want {
+			t.Errorf("Expected input %s, but got: %s", want, diff.Input)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build aix darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package fnrun
+
+import (
+	"os"
+	"syscall"
+)
+
+// socketpair creates a connected pair of Unix domain stream sockets. Both
+// descriptors are marked close-on-exec so that they are only inherited by
+// processes that are explicitly given them.
+//
+// The local end is non-blocking so that closing it interrupts pending reads;
+// the remote end is left blocking because it is meant to be handed to another
+// process.
+func socketpair() (*os.File, *os.File, error) {
+	syscall.ForkLock.RLock()
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+	if err == nil {
+		syscall.CloseOnExec(fds[0])
+		syscall.CloseOnExec(fds[1])
+	}
+	syscall.ForkLock.RUnlock()
+
+	if err != nil {
+		return nil, nil, os.NewSyscallError("socketpair", err)
+	}
+
+	err = syscall.SetNonblock(fds[0], true)
+	if err != nil {
+		syscall.Close(fds[0])
+		syscall.Close(fds[1])
+		return nil, nil, os.NewSyscallError("setnonblock", err)
+	}
+
+	local := os.NewFile(uintptr(fds[0]), "fnrun-local")
+	remote := os.NewFile(uintptr(fds[1]), "fnrun-remote")
+
+	return local, remote, nil
+}
@@ -0,0 +1,14 @@
+//go:build !aix && !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris
+// +build !aix,!darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package fnrun
+
+import (
+	"errors"
+	"os"
+)
+
+// socketpair is only supported on Unix systems.
+func socketpair() (*os.File, *os.File, error) {
+	return nil, nil, errors.New("socket transport is not supported on this platform")
+}
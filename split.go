@@ -0,0 +1,212 @@
+package fnrun
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+)
+
+// WithSplitKey annotates the context with a key that a SplitInvoker uses to
+// send every invocation with the same key to the same target.
+func WithSplitKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, ctxSplitKey, key)
+}
+
+// SplitKey retrieves the split key placed on the context. The second argument
+// is false if there is no split key associated with the context.
+func SplitKey(ctx context.Context) (string, bool) {
+	key, hasKey := ctx.Value(ctxSplitKey).(string)
+	return key, hasKey
+}
+
+// SplitTarget is a pool that a SplitInvoker distributes invocations to.
+type SplitTarget struct {
+	// Name identifies the target in stats and in calls to SetWeights.
+	Name string
+
+	// Pool handles the invocations routed to the target.
+	Pool *InvokerPool
+
+	// Weight is the share of invocations routed to the target relative to the
+	// weights of the other targets. A target with a weight of zero receives no
+	// invocations.
+	Weight int
+}
+
+// SplitTargetStats contains the invocation counts of a target of a
+// SplitInvoker.
+type SplitTargetStats struct {
+	Name        string
+	Weight      int
+	Invocations int64
+	Errors      int64
+}
+
+// ErrorRate returns the fraction of invocations of the target that failed, or
+// zero if it has not been invoked.
+func (stats SplitTargetStats) ErrorRate() float64 {
+	if stats.Invocations == 0 {
+		return 0
+	}
+	return float64(stats.Errors) / float64(stats.Invocations)
+}
+
+type splitTarget struct {
+	name        string
+	pool        *InvokerPool
+	weight      int
+	invocations int64
+	errors      int64
+}
+
+// SplitInvoker is an Invoker that distributes invocations across several
+// InvokerPools by weight, such as to send a small share of traffic to a canary
+// version of a function.
+//
+// An invocation whose context has a key from WithSplitKey is routed by a hash
+// of the key, so invocations with the same key go to the same target for as
+// long as the weights do not change. Other invocations are routed at random.
+//
+// The SplitInvoker does not own its pools; closing them is left to the
+// caller.
+type SplitInvoker struct {
+	mu          sync.RWMutex
+	targets     []*splitTarget
+	totalWeight int
+}
+
+// NewSplitInvoker creates a SplitInvoker that distributes invocations across
+// targets. It returns an error if there are no targets, if a target has no
+// pool, if names are empty or repeated, if a weight is negative, or if all
+// the weights are zero.
+func NewSplitInvoker(targets ...SplitTarget) (*SplitInvoker, error) {
+	if len(targets) == 0 {
+		return nil, errors.New("split invoker must have at least one target")
+	}
+
+	s := &SplitInvoker{}
+	names := make(map[string]bool, len(targets))
+	for _, target := range targets {
+		if target.Name == "" || names[target.Name] {
+			return nil, errors.New("split target names must be unique and not empty")
+		}
+		if target.Pool == nil {
+			return nil, errors.New("split target must have a pool")
+		}
+		if target.Weight < 0 {
+			return nil, errors.New("split target weight must not be negative")
+		}
+		names[target.Name] = true
+
+		s.targets = append(s.targets, &splitTarget{
+			name:   target.Name,
+			pool:   target.Pool,
+			weight: target.Weight,
+		})
+		s.totalWeight += target.Weight
+	}
+
+	if s.totalWeight == 0 {
+		return nil, errors.New("split targets must have a positive total weight")
+	}
+
+	return s, nil
+}
+
+// Invoke satisfies the invocation request with the pool of the target chosen
+// for ctx.
+func (s *SplitInvoker) Invoke(ctx context.Context, input *Input) (*Result, error) {
+	target := s.choose(ctx)
+
+	result, err := target.pool.Invoke(ctx, input)
+	atomic.AddInt64(&target.invocations, 1)
+	if err != nil {
+		atomic.AddInt64(&target.errors, 1)
+	}
+	return result, err
+}
+
+func (s *SplitInvoker) choose(ctx context.Context) *splitTarget {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var n int
+	if key, hasKey := SplitKey(ctx); hasKey {
+		h := fnv.New64a()
+		h.Write([]byte(key))
+		n = int(h.Sum64() % uint64(s.totalWeight))
+	} else {
+		n = rand.Intn(s.totalWeight)
+	}
+
+	for _, target := range s.targets {
+		if n < target.weight {
+			return target
+		}
+		n -= target.weight
+	}
+	// Unreachable while totalWeight is the sum of the weights.
+	return s.targets[len(s.targets)-1]
+}
+
+// SetWeights changes the weights of the named targets, such as to shift more
+// traffic to a canary or to promote it. Targets not named in weights keep
+// their weights. Changing the weights moves some keys to a different target.
+//
+// It returns an error and leaves the weights unchanged if a name is unknown, a
+// weight is negative, or the new weights are all zero.
+func (s *SplitInvoker) SetWeights(weights map[string]int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	known := make(map[string]bool, len(s.targets))
+	total := 0
+	for _, target := range s.targets {
+		known[target.name] = true
+		weight, ok := weights[target.name]
+		if !ok {
+			weight = target.weight
+		}
+		if weight < 0 {
+			return errors.New("split target weight must not be negative")
+		}
+		total += weight
+	}
+	for name := range weights {
+		if !known[name] {
+			return errors.New("unknown split target: " + name)
+		}
+	}
+	if total == 0 {
+		return errors.New("split targets must have a positive total weight")
+	}
+
+	for _, target := range s.targets {
+		if weight, ok := weights[target.name]; ok {
+			target.weight = weight
+		}
+	}
+	s.totalWeight = total
+	return nil
+}
+
+// Stats returns the weight and invocation counts of each target in the order
+// the targets were given to NewSplitInvoker.
+func (s *SplitInvoker) Stats() []SplitTargetStats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stats := make([]SplitTargetStats, 0, len(s.targets))
+	for _, target := range s.targets {
+		stats = append(stats, SplitTargetStats{
+			Name:        target.name,
+			Weight:      target.weight,
+			Invocations: atomic.LoadInt64(&target.invocations),
+			Errors:      atomic.LoadInt64(&target.errors),
+		})
+	}
+	return stats
+}
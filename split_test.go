@@ -0,0 +1,156 @@
+package fnrun
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestSplitInvoker_Invoke_weights(t *testing.T) {
+	stable := newTestPool(t, labelPoolConfig("stable", 1))
+	defer stable.Close()
+	canary := newTestPool(t, labelPoolConfig("canary", 1))
+	defer canary.Close()
+	off := newTestPool(t, labelPoolConfig("off", 1))
+	defer off.Close()
+
+	s, err := NewSplitInvoker(
+		SplitTarget{Name: "stable", Pool: stable, Weight: 1},
+		SplitTarget{Name: "canary", Pool: canary, Weight: 1},
+		SplitTarget{Name: "off", Pool: off, Weight: 0},
+	)
+	if err != nil {
+		t.Fatalf("NewSplitInvoker() returned err: %+v", err)
+	}
+
+	counts := make(map[string]int)
+	for i := 0; i < 200; i++ {
+		counts[invokeData(context.Background(), t, s)]++
+	}
+
+	if counts["stable"] == 0 || counts["canary"] == 0 {
+		t.Errorf("Expected invocations to be split between stable and canary, but got: %v", counts)
+	}
+	if counts["off"] != 0 {
+		t.Errorf("Expected no invocations of a target with zero weight, but got: %v", counts)
+	}
+}
+
+func TestSplitInvoker_Invoke_sticky(t *testing.T) {
+	stable := newTestPool(t, labelPoolConfig("stable", 1))
+	defer stable.Close()
+	canary := newTestPool(t, labelPoolConfig("canary", 1))
+	defer canary.Close()
+
+	s, err := NewSplitInvoker(
+		SplitTarget{Name: "stable", Pool: stable, Weight: 9},
+		SplitTarget{Name: "canary", Pool: canary, Weight: 1},
+	)
+	if err != nil {
+		t.Fatalf("NewSplitInvoker() returned err: %+v", err)
+	}
+
+	seen := make(map[string]bool)
+	for i := 0; i < 50; i++ {
+		ctx := WithSplitKey(context.Background(), fmt.Sprintf("user-%d", i))
+		first := invokeData(ctx, t, s)
+		seen[first] = true
+		for j := 0; j < 5; j++ {
+			if got := invokeData(ctx, t, s); got != first {
+				t.Fatalf("Expected key user-%d to stay on %s, but got: %s", i, first, got)
+			}
+		}
+	}
+
+	if !seen["stable"] || !seen["canary"] {
+		t.Errorf("Expected keys to be assigned to both targets, but got: %v", seen)
+	}
+}
+
+func TestSplitInvoker_Stats(t *testing.T) {
+	stable := newTestPool(t, labelPoolConfig("stable", 1))
+	defer stable.Close()
+	canary := newTestPool(t, failingPoolConfig(1))
+	defer canary.Close()
+
+	s, err := NewSplitInvoker(
+		SplitTarget{Name: "stable", Pool: stable, Weight: 1},
+		SplitTarget{Name: "canary", Pool: canary, Weight: 1},
+	)
+	if err != nil {
+		t.Fatalf("NewSplitInvoker() returned err: %+v", err)
+	}
+
+	for i := 0; i < 100; i++ {
+		s.Invoke(context.Background(), &Input{})
+	}
+
+	stats := s.Stats()
+	if len(stats) != 2 || stats[0].Name != "stable" || stats[1].Name != "canary" {
+		t.Fatalf("Expected stats for stable and canary, but got: %+v", stats)
+	}
+	if stats[0].Invocations+stats[1].Invocations != 100 {
+		t.Errorf("Expected 100 invocations in total, but got: %+v", stats)
+	}
+	if stats[0].ErrorRate() != 0 {
+		t.Errorf("Expected no errors for stable, but got: %+v", stats[0])
+	}
+	if stats[1].Invocations == 0 || stats[1].ErrorRate() != 1 {
+		t.Errorf("Expected every invocation of canary to fail, but got: %+v", stats[1])
+	}
+}
+
+func TestSplitInvoker_SetWeights(t *testing.T) {
+	stable := newTestPool(t, labelPoolConfig("stable", 1))
+	defer stable.Close()
+	canary := newTestPool(t, labelPoolConfig("canary", 1))
+	defer canary.Close()
+
+	s, err := NewSplitInvoker(
+		SplitTarget{Name: "stable", Pool: stable, Weight: 1},
+		SplitTarget{Name: "canary", Pool: canary, Weight: 0},
+	)
+	if err != nil {
+		t.Fatalf("NewSplitInvoker() returned err: %+v", err)
+	}
+
+	if err := s.SetWeights(map[string]int{"unknown": 1}); err == nil {
+		t.Error("Expected an error for an unknown target")
+	}
+	if err := s.SetWeights(map[string]int{"stable": 0}); err == nil {
+		t.Error("Expected an error for a zero total weight")
+	}
+	if got := invokeData(context.Background(), t, s); got != "stable" {
+		t.Errorf("Expected failed SetWeights calls to leave the weights unchanged, but got: %s", got)
+	}
+
+	if err := s.SetWeights(map[string]int{"stable": 0, "canary": 1}); err != nil {
+		t.Fatalf("SetWeights() returned err: %+v", err)
+	}
+	if got := invokeData(WithSplitKey(context.Background(), "key"), t, s); got != "canary" {
+		t.Errorf("Expected the promoted canary, but got: %s", got)
+	}
+}
+
+func TestNewSplitInvoker_invalid(t *testing.T) {
+	pool := newTestPool(t, labelPoolConfig("stable", 1))
+	defer pool.Close()
+
+	tests := []struct {
+		name    string
+		targets []SplitTarget
+	}{
+		{"no targets", nil},
+		{"no name", []SplitTarget{{Pool: pool, Weight: 1}}},
+		{"repeated name", []SplitTarget{{Name: "a", Pool: pool, Weight: 1}, {Name: "a", Pool: pool, Weight: 1}}},
+		{"no pool", []SplitTarget{{Name: "a", Weight: 1}}},
+		{"negative weight", []SplitTarget{{Name: "a", Pool: pool, Weight: -1}, {Name: "b", Pool: pool, Weight: 2}}},
+		{"zero total weight", []SplitTarget{{Name: "a", Pool: pool}}},
+	}
+
+	for _, tt := range tests {
+		if _, err := NewSplitInvoker(tt.targets...); err == nil {
+			t.Errorf("Expected an error for %s", tt.name)
+		}
+	}
+}
@@ -0,0 +1,256 @@
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build aix darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package fnrun
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// ZygoteFDEnvVar is the name of the environment variable that tells a zygote
+// process which file descriptor carries its control channel.
+const ZygoteFDEnvVar = "FNRUN_ZYGOTE_FD"
+
+// zygoteRequest is the message sent over the control channel to ask the zygote
+// for a new worker.
+const zygoteRequest = "fork\n"
+
+// zygoteKillRequest is the prefix of the message sent over the control channel
+// to ask the zygote to kill one of its workers. It is followed by the pid of
+// the worker and a newline.
+const zygoteKillRequest = "kill "
+
+type zygoteInvokerFactory struct {
+	cmd     *exec.Cmd
+	control *net.UnixConn
+	replies *bufio.Reader
+
+	// mu serializes fork requests and their replies on the control channel,
+	// and writeMu serializes writes so that kill requests, which have no
+	// reply, need not wait for a fork to complete.
+	mu      sync.Mutex
+	writeMu sync.Mutex
+}
+
+// NewZygoteInvokerFactory starts cmd as a zygote process and returns a factory
+// that creates invokers by asking the zygote to fork new workers.
+//
+// The zygote is expected to perform any expensive initialization, such as
+// starting an interpreter and importing modules, once before serving requests
+// so that the workers it forks start already initialized.
+//
+// The zygote receives a Unix domain socket control channel on the file
+// descriptor named by the FNRUN_ZYGOTE_FD environment variable. For each new
+// invoker, the runner sends the line "fork" on the control channel along with a
+// single file descriptor passed as SCM_RIGHTS ancillary data. The zygote must
+// fork a worker that uses that descriptor as both its stdin and stdout and
+// speaks the normal fnrun protocol over it, close its own copy of the
+// descriptor, and reply with a line containing the decimal pid of the worker.
+// If the worker cannot be created, the zygote replies with a line that starts
+// with "!" followed by an error message.
+//
+// The zygote is responsible for reaping and killing the workers it forks, since
+// they are not children of the runner. To stop a worker that has run past its
+// deadline or has not exited after being closed, the runner sends a line
+// containing "kill" and the decimal pid of the worker, to which the zygote does
+// not reply. The zygote must send SIGKILL to the worker only if it has not yet
+// reaped it, and ignore the request otherwise, so that a reused pid is never
+// signaled. Workers should exit when they read EOF from stdin.
+//
+// For the same reason, the resident set size of workers is not sampled, and
+// the MaxInvokerRSS setting of a pool does not apply to these invokers.
+//
+// This function assumes control of the cmd, and it is the responsibility of the
+// caller to ensure that the cmd is not used after being provided to this
+// function. The returned object also implements io.Closer; calling Close stops
+// the zygote but does not affect workers that have already been created, which
+// can then no longer be killed by the runner.
+func NewZygoteInvokerFactory(cmd *exec.Cmd) (InvokerFactory, error) {
+	local, remote, err := socketpair()
+	if err != nil {
+		return nil, err
+	}
+	defer remote.Close()
+
+	control, err := net.FileConn(local)
+	local.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	fd := appendExtraFile(cmd, remote)
+	appendEnv(cmd, ZygoteFDEnvVar+"="+strconv.Itoa(fd))
+
+	err = cmd.Start()
+	if err != nil {
+		control.Close()
+		return nil, err
+	}
+
+	factory := &zygoteInvokerFactory{
+		cmd:     cmd,
+		control: control.(*net.UnixConn),
+		replies: bufio.NewReader(control),
+	}
+
+	return factory, nil
+}
+
+func (factory *zygoteInvokerFactory) NewInvoker() (Invoker, error) {
+	local, remote, err := socketpair()
+	if err != nil {
+		return nil, err
+	}
+	defer remote.Close()
+
+	pid, err := factory.fork(remote)
+	if err != nil {
+		local.Close()
+		return nil, err
+	}
+
+	invoker := &zygoteInvoker{
+		factory: factory,
+		conn:    local,
+		pid:     pid,
+	}
+
+	return invoker, nil
+}
+
+// fork asks the zygote to start a worker that communicates over conn and
+// returns the pid of the worker.
+func (factory *zygoteInvokerFactory) fork(conn *os.File) (int, error) {
+	factory.mu.Lock()
+	defer factory.mu.Unlock()
+
+	rights := syscall.UnixRights(int(conn.Fd()))
+	factory.writeMu.Lock()
+	_, _, err := factory.control.WriteMsgUnix([]byte(zygoteRequest), rights, nil)
+	factory.writeMu.Unlock()
+	if err != nil {
+		return 0, err
+	}
+
+	reply, err := factory.replies.ReadString('\n')
+	if err != nil {
+		return 0, err
+	}
+	reply = strings.TrimSuffix(reply, "\n")
+
+	if strings.HasPrefix(reply, "!") {
+		return 0, errors.New("zygote could not fork worker: " + reply[1:])
+	}
+
+	pid, err := strconv.Atoi(reply)
+	if err != nil {
+		return 0, errors.New("zygote returned invalid pid: " + reply)
+	}
+
+	return pid, nil
+}
+
+// kill asks the zygote to kill the worker with the given pid.
+func (factory *zygoteInvokerFactory) kill(pid int) error {
+	factory.writeMu.Lock()
+	defer factory.writeMu.Unlock()
+
+	_, err := factory.control.Write([]byte(zygoteKillRequest + strconv.Itoa(pid) + "\n"))
+	return err
+}
+
+// Close stops the zygote by closing its control channel, killing it if it has
+// not exited within closeGracePeriod.
+func (factory *zygoteInvokerFactory) Close() error {
+	factory.mu.Lock()
+	defer factory.mu.Unlock()
+
+	factory.control.Close()
+
+	done := make(chan struct{})
+	go func() {
+		factory.cmd.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(closeGracePeriod):
+		factory.cmd.Process.Kill()
+		<-done
+	}
+
+	return nil
+}
+
+// zygoteInvoker is an Invoker backed by a worker forked from a zygote.
+//
+// The worker is not a child of this process, so its pid may be reused once the
+// zygote reaps it. The worker is therefore never signaled directly or looked up
+// by pid; it is killed by the zygote, and its exit is detected through its
+// connection.
+type zygoteInvoker struct {
+	factory   *zygoteInvokerFactory
+	conn      *os.File
+	pid       int
+	closeOnce sync.Once
+}
+
+func (zi *zygoteInvoker) Invoke(ctx context.Context, input *Input) (*Result, error) {
+	kill := func() {
+		zi.factory.kill(zi.pid)
+		zi.conn.Close()
+	}
+	return invokeStream(ctx, ProtobufCodec, input, zi.conn, zi.conn, kill)
+}
+
+// Close shuts down the sending side of the connection to the worker so that it
+// reads EOF from stdin, and waits for the worker to close the connection by
+// exiting. If that does not happen within closeGracePeriod, the zygote is asked
+// to kill the worker.
+func (zi *zygoteInvoker) Close() error {
+	zi.closeOnce.Do(func() {
+		defer zi.conn.Close()
+
+		if err := shutdownWrite(zi.conn); err != nil {
+			zi.factory.kill(zi.pid)
+			return
+		}
+
+		zi.conn.SetReadDeadline(time.Now().Add(closeGracePeriod))
+		if _, err := io.Copy(ioutil.Discard, zi.conn); err != nil {
+			zi.factory.kill(zi.pid)
+		}
+	})
+
+	return nil
+}
+
+// shutdownWrite shuts down the sending side of the socket conn.
+func shutdownWrite(conn *os.File) error {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var shutdownErr error
+	err = raw.Control(func(fd uintptr) {
+		shutdownErr = syscall.Shutdown(int(fd), syscall.SHUT_WR)
+	})
+	if err != nil {
+		return err
+	}
+	return shutdownErr
+}
@@ -0,0 +1,288 @@
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build aix darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package fnrun
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestNewZygoteInvokerFactory(t *testing.T) {
+	cmd := exec.Command(os.Args[0], "-test.run=Test_ZygoteSubprocess")
+	cmd.Env = append(os.Environ(), "GO_RUNNING_SUBPROCESS=1")
+
+	factory, err := NewZygoteInvokerFactory(cmd)
+
+	if err != nil {
+		t.Fatalf("NewZygoteInvokerFactory() returned error: %+v", err)
+	}
+	defer factory.(io.Closer).Close()
+
+	for i := 0; i < 2; i++ {
+		invoker, err := factory.NewInvoker()
+
+		if err != nil {
+			t.Fatalf("NewInvoker() returned error: %+v", err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		input := Input{Data: []byte("world")}
+		result, err := invoker.Invoke(ctx, &input)
+
+		if err != nil {
+			t.Fatalf("Invoke() returned err: %+v", err)
+		}
+
+		want := "Hello, world!"
+		got := string(result.Data)
+
+		if want != got {
+			t.Errorf("Did not read expected result: got %s; want %s", got, want)
+		}
+
+		if _, ok := invoker.(rssSampler); ok {
+			t.Errorf("Expected the RSS of a worker not to be sampled by pid")
+		}
+
+		invoker.(io.Closer).Close()
+	}
+}
+
+func TestZygoteInvoker_Invoke_runTooLong(t *testing.T) {
+	cmd := exec.Command(os.Args[0], "-test.run=Test_ZygoteSubprocess")
+	cmd.Env = append(os.Environ(), "GO_RUNNING_SUBPROCESS=1", "ZYGOTE_WORKER=Test_HangingSubprocess")
+
+	factory, err := NewZygoteInvokerFactory(cmd)
+
+	if err != nil {
+		t.Fatalf("NewZygoteInvokerFactory() returned error: %+v", err)
+	}
+	defer factory.(io.Closer).Close()
+
+	invoker, err := factory.NewInvoker()
+
+	if err != nil {
+		t.Fatalf("NewInvoker() returned error: %+v", err)
+	}
+	defer invoker.(io.Closer).Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	_, err = invoker.Invoke(ctx, &Input{})
+
+	if err != context.DeadlineExceeded {
+		t.Errorf("Expected deadline exceeded error, but got: %+v", err)
+	}
+
+	// The worker is a child of the zygote in the test, so it is gone once the
+	// zygote has killed and reaped it.
+	pid := invoker.(*zygoteInvoker).pid
+	waitFor(t, func() bool { return syscall.Kill(pid, 0) == syscall.ESRCH })
+}
+
+func TestZygoteInvoker_Close(t *testing.T) {
+	cmd := exec.Command(os.Args[0], "-test.run=Test_ZygoteSubprocess")
+	cmd.Env = append(os.Environ(), "GO_RUNNING_SUBPROCESS=1")
+
+	factory, err := NewZygoteInvokerFactory(cmd)
+
+	if err != nil {
+		t.Fatalf("NewZygoteInvokerFactory() returned error: %+v", err)
+	}
+	defer factory.(io.Closer).Close()
+
+	invoker, err := factory.NewInvoker()
+
+	if err != nil {
+		t.Fatalf("NewInvoker() returned error: %+v", err)
+	}
+
+	start := time.Now()
+	invoker.(io.Closer).Close()
+
+	if elapsed := time.Since(start); elapsed > closeGracePeriod/2 {
+		t.Errorf("Expected Close() to return once the worker exited, but took: %v", elapsed)
+	}
+}
+
+func TestNewZygoteInvokerFactory_forkErr(t *testing.T) {
+	cmd := exec.Command(os.Args[0], "-test.run=Test_FailingZygoteSubprocess")
+	cmd.Env = append(os.Environ(), "GO_RUNNING_SUBPROCESS=1")
+
+	factory, err := NewZygoteInvokerFactory(cmd)
+
+	if err != nil {
+		t.Fatalf("NewZygoteInvokerFactory() returned error: %+v", err)
+	}
+	defer factory.(io.Closer).Close()
+
+	invoker, err := factory.NewInvoker()
+
+	if err == nil {
+		t.Errorf("NewInvoker() did not return error")
+	}
+
+	if invoker != nil {
+		t.Errorf("NewInvoker(): expected invoker to be nil but got: %+v", invoker)
+	}
+}
+
+func TestNewZygoteInvokerFactory_doesNotExist(t *testing.T) {
+	cmd := exec.Command("does_not_exist")
+
+	_, err := NewZygoteInvokerFactory(cmd)
+
+	if err == nil {
+		t.Errorf("NewZygoteInvokerFactory() did not return error")
+	}
+}
+
+// -----------------------------------------------------------------------------
+// Following are zygote subprocesses used for testing.
+
+// Test_ZygoteSubprocess simulates a zygote. Go cannot fork safely, so each
+// worker is started with the test named by ZYGOTE_WORKER, or
+// Test_GreetingSubprocess, instead.
+func Test_ZygoteSubprocess(t *testing.T) {
+	if os.Getenv("GO_RUNNING_SUBPROCESS") != "1" {
+		return
+	}
+
+	workerTest := os.Getenv("ZYGOTE_WORKER")
+	if workerTest == "" {
+		workerTest = "Test_GreetingSubprocess"
+	}
+
+	var mu sync.Mutex
+	workers := make(map[int]*os.Process)
+
+	control := zygoteControl()
+	serveZygoteRequests(control, func(worker *os.File) {
+		cmd := exec.Command(os.Args[0], "-test.run="+workerTest)
+		cmd.Stdin = worker
+		cmd.Stdout = worker
+		err := cmd.Start()
+		worker.Close()
+
+		if err != nil {
+			fmt.Fprintf(control, "!%v\n", err)
+			return
+		}
+
+		pid := cmd.Process.Pid
+		mu.Lock()
+		workers[pid] = cmd.Process
+		mu.Unlock()
+
+		go func() {
+			cmd.Wait()
+			mu.Lock()
+			delete(workers, pid)
+			mu.Unlock()
+		}()
+
+		fmt.Fprintf(control, "%d\n", pid)
+	}, func(pid int) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		// os.Process does not signal a process once it has been waited for.
+		if worker, ok := workers[pid]; ok {
+			worker.Kill()
+		}
+	})
+}
+
+func Test_FailingZygoteSubprocess(t *testing.T) {
+	if os.Getenv("GO_RUNNING_SUBPROCESS") != "1" {
+		return
+	}
+
+	control := zygoteControl()
+	serveZygoteRequests(control, func(worker *os.File) {
+		worker.Close()
+		fmt.Fprintf(control, "!no workers available\n")
+	}, func(int) {})
+}
+
+func Test_HangingSubprocess(t *testing.T) {
+	if os.Getenv("GO_RUNNING_SUBPROCESS") != "1" {
+		return
+	}
+
+	time.Sleep(time.Hour)
+}
+
+func zygoteControl() *net.UnixConn {
+	fd, _ := strconv.Atoi(os.Getenv(ZygoteFDEnvVar))
+	conn, _ := net.FileConn(os.NewFile(uintptr(fd), "control"))
+	return conn.(*net.UnixConn)
+}
+
+// serveZygoteRequests reads requests from the control channel until it is
+// closed, calling fork with the connection passed with each fork request and
+// kill with the pid of each kill request.
+func serveZygoteRequests(control *net.UnixConn, fork func(*os.File), kill func(int)) {
+	buf := make([]byte, 256)
+	oob := make([]byte, syscall.CmsgSpace(4))
+
+	var pending []byte
+	var conns []*os.File
+	for {
+		n, oobn, _, _, err := control.ReadMsgUnix(buf, oob)
+		if err != nil || n == 0 {
+			return
+		}
+
+		if oobn > 0 {
+			msgs, err := syscall.ParseSocketControlMessage(oob[:oobn])
+			if err != nil {
+				return
+			}
+			for _, msg := range msgs {
+				fds, err := syscall.ParseUnixRights(&msg)
+				if err != nil {
+					return
+				}
+				for _, fd := range fds {
+					conns = append(conns, os.NewFile(uintptr(fd), "worker"))
+				}
+			}
+		}
+
+		pending = append(pending, buf[:n]...)
+		for {
+			i := bytes.IndexByte(pending, '\n')
+			if i < 0 {
+				break
+			}
+			line := string(pending[:i+1])
+			pending = pending[i+1:]
+
+			switch {
+			case line == zygoteRequest && len(conns) > 0:
+				conn := conns[0]
+				conns = conns[1:]
+				fork(conn)
+			case strings.HasPrefix(line, zygoteKillRequest):
+				pid, _ := strconv.Atoi(strings.TrimSpace(line[len(zygoteKillRequest):]))
+				kill(pid)
+			}
+		}
+	}
+}